@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// batchRange is a single range of a /batch request body
+type batchRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// parseBatch parses a comma separated list of offset:length pairs
+func parseBatch(spec string) ([]batchRange, error) {
+	var ranges []batchRange
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("failed to parse batch range '%s'", entry)
+		}
+
+		offset, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse batch range offset '%s'", parts[0])
+		}
+
+		length, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse batch range length '%s'", parts[1])
+		}
+
+		ranges = append(ranges, batchRange{Offset: offset, Length: length})
+	}
+	return ranges, nil
+}
+
+func sendBatch(client *http.Client, url, spec string, vbs bool) error {
+	ranges, err := parseBatch(spec)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(ranges)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url+"/batch", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	res, b, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		fmt.Printf("did not receive expected status: url: %s batch: %s expected: %d actual: %d\n", req.URL, spec, http.StatusOK, res.StatusCode)
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	if mediaType != "multipart/byteranges" {
+		return errors.New("unexpected batch response content type: " + mediaType)
+	}
+
+	fmt.Println("batch parts:")
+	mr := multipart.NewReader(bytes.NewReader(b), params["boundary"])
+	for i := 0; ; i++ {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		partBytes, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("part %d content-range: %s length: %d\n", i, part.Header.Get("Content-Range"), len(partBytes))
+		if i >= len(ranges) {
+			fmt.Printf("received more parts than requested: requested: %d\n", len(ranges))
+		} else if int64(len(partBytes)) != ranges[i].Length {
+			fmt.Printf("requested bytes did not match bytes served: part: %d requested: %d served: %d\n", i, ranges[i].Length, len(partBytes))
+		}
+	}
+	fmt.Println()
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// volatileHeaders differ between responses from equivalent servers, so are left out of comparisons
+var volatileHeaders = map[string]bool{
+	"Date":          true,
+	"Last-Modified": true,
+	"X-Request-Id":  true,
+	"Keep-Alive":    true,
+}
+
+// comparisonRequest is a request of the comparison suite, as a path and headers
+type comparisonRequest struct {
+	desc    string
+	path    string
+	headers map[string]string
+}
+
+// comparisonSuite are the sample range requests followed by a request for all content
+func comparisonSuite() []comparisonRequest {
+	var suite []comparisonRequest
+	for _, rng := range []string{sampleRangeStart, sampleRangeMid, sampleRangeEnd} {
+		suite = append(suite, comparisonRequest{desc: "range header " + rng, path: "/", headers: map[string]string{"Range": rng}})
+	}
+	for _, rng := range []string{sampleRangeStart, sampleRangeMid, sampleRangeEnd, sampleDoltSuffix} {
+		suite = append(suite, comparisonRequest{desc: "x-dolt-range header " + rng, path: "/", headers: map[string]string{"X-Dolt-Range": rng}})
+	}
+	for _, params := range []string{sampleParamsStart, sampleParamsMid, sampleParamsEnd} {
+		suite = append(suite, comparisonRequest{desc: "params " + params, path: "/?" + params})
+	}
+	suite = append(suite, comparisonRequest{desc: "all content", path: "/"})
+	return suite
+}
+
+// sendComparison sends the comparison suite to both servers and reports differences in the status codes,
+// headers and bodies of their responses, ignoring volatile headers.
+func sendComparison(client *http.Client, url string, compareClient *http.Client, compareUrl string, vbs bool) error {
+	var diffs []string
+	suite := comparisonSuite()
+	for _, cr := range suite {
+		res, b, err := sendComparisonRequest(client, url, cr, vbs)
+		if err != nil {
+			return err
+		}
+		compareRes, compareB, err := sendComparisonRequest(compareClient, compareUrl, cr, vbs)
+		if err != nil {
+			return err
+		}
+
+		if res.StatusCode != compareRes.StatusCode {
+			diffs = append(diffs, fmt.Sprintf("%s: status: %d vs %d", cr.desc, res.StatusCode, compareRes.StatusCode))
+		}
+		for _, name := range headerNames(res.Header, compareRes.Header) {
+			value := strings.Join(res.Header.Values(name), ", ")
+			compareValue := strings.Join(compareRes.Header.Values(name), ", ")
+			if value != compareValue {
+				diffs = append(diffs, fmt.Sprintf("%s: header %s: '%s' vs '%s'", cr.desc, name, value, compareValue))
+			}
+		}
+		if !bytes.Equal(b, compareB) {
+			diffs = append(diffs, fmt.Sprintf("%s: body: %d bytes vs %d bytes, first difference at byte %d", cr.desc, len(b), len(compareB), firstDifference(b, compareB)))
+		}
+	}
+
+	fmt.Printf("comparison of %s with %s:\n", url, compareUrl)
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+	fmt.Printf("%d differences in %d requests\n", len(diffs), len(suite))
+	fmt.Println()
+
+	return nil
+}
+
+func sendComparisonRequest(client *http.Client, url string, cr comparisonRequest, vbs bool) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url+cr.path, http.NoBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, value := range cr.headers {
+		req.Header.Set(name, value)
+	}
+	return roundTrip(client, req, vbs)
+}
+
+// headerNames returns the sorted names of the non-volatile headers present in either set of headers
+func headerNames(a, b http.Header) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, h := range []http.Header{a, b} {
+		for name := range h {
+			if !volatileHeaders[name] && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// firstDifference returns the offset of the first byte that differs between a and b
+func firstDifference(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) < len(b) {
+		return len(a)
+	}
+	return len(b)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// etagListMatches reports whether a comma separated list of entity tags matches etag. `*` matches any
+// etag. Strong comparison, required by If-Match, never matches weak tags.
+func etagListMatches(list, etag string, strong bool) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strong {
+			if tag == etag && !strings.HasPrefix(tag, "W/") {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch asserts that a request sent with If-Match was served only if the response's ETag matches,
+// and was otherwise answered with 412 Precondition Failed.
+func checkIfMatch(ifMatch string, res *http.Response) {
+	etag := res.Header.Get("ETag")
+	matches := etag != "" && etagListMatches(ifMatch, etag, true)
+
+	switch {
+	case res.StatusCode == http.StatusPreconditionFailed && matches:
+		fmt.Printf("received 412 although if-match matched: if-match: %s etag: %s\n", ifMatch, etag)
+	case res.StatusCode == http.StatusPreconditionFailed:
+		fmt.Printf("if-match precondition failed: if-match: %s etag: %s\n", ifMatch, etag)
+	case res.StatusCode < 300 && !matches:
+		fmt.Printf("served although if-match did not match: if-match: %s etag: %s status: %d\n", ifMatch, etag, res.StatusCode)
+	case res.StatusCode < 300:
+		fmt.Printf("if-match precondition passed: if-match: %s etag: %s\n", ifMatch, etag)
+	}
+}
+
+// checkIfNoneMatch asserts that a request sent with If-None-Match was answered with 304 Not Modified only
+// if the response's ETag matches, and was otherwise served.
+func checkIfNoneMatch(ifNoneMatch string, res *http.Response) {
+	etag := res.Header.Get("ETag")
+	matches := etag != "" && etagListMatches(ifNoneMatch, etag, false)
+
+	switch {
+	case res.StatusCode == http.StatusNotModified && !matches:
+		fmt.Printf("received 304 although if-none-match did not match: if-none-match: %s etag: %s\n", ifNoneMatch, etag)
+	case res.StatusCode == http.StatusNotModified:
+		fmt.Printf("if-none-match not modified: if-none-match: %s etag: %s\n", ifNoneMatch, etag)
+	case res.StatusCode < 300 && matches:
+		fmt.Printf("served although if-none-match matched: if-none-match: %s etag: %s status: %d\n", ifNoneMatch, etag, res.StatusCode)
+	case res.StatusCode < 300:
+		fmt.Printf("if-none-match missed: if-none-match: %s etag: %s\n", ifNoneMatch, etag)
+	}
+}
+
+// ifRangeCase is a range request sent with an If-Range validator, and the status it should receive
+type ifRangeCase struct {
+	desc     string
+	ifRange  string
+	expected int
+}
+
+// sendIfRangeMatrix requests the full content to learn its ETag and Last-Modified, then sends a range
+// request with a matching and a non-matching etag and date in If-Range, checking matching validators are
+// answered with the range and others with all content.
+func sendIfRangeMatrix(client *http.Client, url string, vbs bool) error {
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	res, _, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return err
+	}
+
+	etag := res.Header.Get("ETag")
+	lastModified := res.Header.Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		fmt.Printf("response is missing validators: etag: '%s' last-modified: '%s'\n", etag, lastModified)
+		return nil
+	}
+
+	modTime, err := http.ParseTime(lastModified)
+	if err != nil {
+		return err
+	}
+
+	// a weak etag is never a valid If-Range validator, even one matching the response's own etag
+	matchingExpected := http.StatusPartialContent
+	if strings.HasPrefix(etag, "W/") {
+		matchingExpected = http.StatusOK
+	}
+	opaque := strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+
+	cases := []ifRangeCase{
+		{desc: "matching etag", ifRange: etag, expected: matchingExpected},
+		{desc: "non-matching etag", ifRange: `"not-` + opaque + `"`, expected: http.StatusOK},
+		{desc: "weak etag", ifRange: `W/"` + opaque + `"`, expected: http.StatusOK},
+		{desc: "matching date", ifRange: lastModified, expected: http.StatusPartialContent},
+		{desc: "stale date", ifRange: modTime.Add(-time.Hour).Format(http.TimeFormat), expected: http.StatusOK},
+	}
+
+	return sendIfRangeCases(client, url, cases, vbs)
+}
+
+// sendIfRangeDate learns the content's Last-Modified with a HEAD request, then sends range requests with
+// If-Range dates equal to, newer and older than it, checking the equal and newer dates are answered with the
+// range and the older one with all content. Serving the newer date's range is the headers tester server's
+// lenient behavior, RFC 9110 requires an exact date match.
+func sendIfRangeDate(client *http.Client, url string, vbs bool) error {
+	req, err := http.NewRequest(http.MethodHead, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	res, _, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return err
+	}
+
+	lastModified := res.Header.Get("Last-Modified")
+	if lastModified == "" {
+		fmt.Println("head response is missing last-modified")
+		return nil
+	}
+
+	modTime, err := http.ParseTime(lastModified)
+	if err != nil {
+		return err
+	}
+
+	cases := []ifRangeCase{
+		{desc: "equal date", ifRange: lastModified, expected: http.StatusPartialContent},
+		{desc: "newer date", ifRange: modTime.Add(time.Hour).Format(http.TimeFormat), expected: http.StatusPartialContent},
+		{desc: "older date", ifRange: modTime.Add(-time.Second).Format(http.TimeFormat), expected: http.StatusOK},
+	}
+
+	return sendIfRangeCases(client, url, cases, vbs)
+}
+
+// sendIfRangeCases sends a range request for each case and prints whether each was answered with the
+// expected status
+func sendIfRangeCases(client *http.Client, url string, cases []ifRangeCase, vbs bool) error {
+	var results []string
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Range", "bytes=0-99")
+		req.Header.Set("If-Range", c.ifRange)
+
+		res, _, err := roundTrip(client, req, vbs)
+		if err != nil {
+			return err
+		}
+
+		outcome := "ok"
+		if res.StatusCode != c.expected {
+			outcome = "FAILED"
+		}
+		results = append(results, fmt.Sprintf("%s %s: if-range: %s expected: %d actual: %d", outcome, c.desc, c.ifRange, c.expected, res.StatusCode))
+	}
+
+	fmt.Println("if-range results:")
+	for _, result := range results {
+		fmt.Println(result)
+	}
+	fmt.Println()
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// sendEcho requests /echo and pretty prints the request as the server received it
+func sendEcho(client *http.Client, url string, vbs bool) error {
+	req, err := http.NewRequest(http.MethodGet, url+"/echo", http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	res, b, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		fmt.Printf("did not receive expected status: url: %s expected: %d actual: %d\n", req.URL, http.StatusOK, res.StatusCode)
+		return nil
+	}
+
+	var out bytes.Buffer
+	if err = json.Indent(&out, b, "", "  "); err != nil {
+		return err
+	}
+
+	fmt.Println("server received:")
+	fmt.Println(out.String())
+	fmt.Println()
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// decodeBody decodes a response body according to its Content-Encoding
+func decodeBody(contentEncoding string, b []byte) ([]byte, error) {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return b, nil
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(b))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding '%s'", contentEncoding)
+	}
+	return io.ReadAll(r)
+}
+
+// printCompression prints the bytes received on the wire for an encoded body, the bytes it decoded to
+// and the ratio between them
+func printCompression(contentEncoding string, wireLen, decodedLen int) {
+	ratio := 0.0
+	if wireLen > 0 {
+		ratio = float64(decodedLen) / float64(wireLen)
+	}
+	fmt.Printf("compression: %s wire bytes: %d decoded bytes: %d ratio: %.2f\n", contentEncoding, wireLen, decodedLen, ratio)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// categories of client failures
+const (
+	errKindDNS         = "dns lookup failed"
+	errKindRefused     = "connection refused"
+	errKindTimeout     = "timed out"
+	errKindCertificate = "tls certificate verification failed"
+	errKindNotTLS      = "tls handshake failed, the server did not respond with tls"
+	errKindTLSAlert    = "tls handshake rejected by the server"
+	errKindConnection  = "connection failed"
+	errKindRequest     = "request failed"
+)
+
+// clientError is a failure categorized by its cause, with a hint at how to address it
+type clientError struct {
+	kind string
+	hint string
+	err  error
+}
+
+func (e *clientError) Error() string {
+	return fmt.Sprintf("%s: %s", e.kind, e.err.Error())
+}
+
+func (e *clientError) Unwrap() error {
+	return e.err
+}
+
+// classifyError categorizes dns, connection, timeout and tls failures
+func classifyError(err error) *clientError {
+	var ce *clientError
+	if errors.As(err, &ce) {
+		return ce
+	}
+
+	var dnsErr *net.DNSError
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	var recordHeaderErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var netErr net.Error
+	var opErr *net.OpError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return &clientError{kind: errKindDNS, hint: "check --host, or pin an address with --resolve", err: err}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return &clientError{kind: errKindRefused, hint: "check the server is running and --host and --port", err: err}
+	case errors.As(err, &verifyErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr), errors.As(err, &invalidCert):
+		return &clientError{kind: errKindCertificate, hint: "check --tls-cert-file and --tls-servername, or use --tls-skip-verify", err: err}
+	// net/http replaces the tls record header error with a plain error when the response looks like http
+	case errors.As(err, &recordHeaderErr), strings.Contains(err.Error(), "server gave HTTP response to HTTPS client"):
+		return &clientError{kind: errKindNotTLS, hint: "the port may be serving plain http, check --port and the tls flags", err: err}
+	case errors.As(err, &alertErr):
+		return &clientError{kind: errKindTLSAlert, hint: "the server may require a client certificate, see --tls-cert-file and --tls-key-file", err: err}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return &clientError{kind: errKindTimeout, hint: "the server may be overloaded or unreachable", err: err}
+	case errors.Is(err, syscall.ECONNRESET), errors.As(err, &opErr):
+		return &clientError{kind: errKindConnection, hint: "the connection was reset or closed by the server", err: err}
+	}
+	return &clientError{kind: errKindRequest, err: err}
+}
+
+// exitWithError prints a categorized error and its hint, then exits non-zero
+func exitWithError(err error) {
+	ce := classifyError(err)
+	fmt.Println("error:", ce.Error())
+	if ce.hint != "" {
+		fmt.Println("hint:", ce.hint)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dolthub/headers_tester/version"
+)
+
+// harRecorder collects the requests made by the client as HTTP Archive 1.2 entries
+type harRecorder struct {
+	mu      *sync.Mutex
+	entries []harEntry
+}
+
+var har = &harRecorder{mu: &sync.Mutex{}}
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// harTimings are in milliseconds, -1 for phases that did not happen
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	nvs := []harNameValue{}
+	for name, values := range h {
+		for _, value := range values {
+			nvs = append(nvs, harNameValue{Name: name, Value: value})
+		}
+	}
+	return nvs
+}
+
+func harMillis(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return -1
+	}
+	return float64(end.Sub(start)) / float64(time.Millisecond)
+}
+
+// harPhase is harMillis for the send, wait and receive phases, which har requires to be non-negative
+func harPhase(start, end time.Time) float64 {
+	if ms := harMillis(start, end); ms > 0 {
+		return ms
+	}
+	return 0
+}
+
+// record adds an entry for a request, its response and fully read body, and the trace timings gathered
+// while making it
+func (h *harRecorder) record(req *http.Request, res *http.Response, b []byte, t *requestTimings) {
+	query := []harNameValue{}
+	for key, values := range req.URL.Query() {
+		for _, value := range values {
+			query = append(query, harNameValue{Name: key, Value: value})
+		}
+	}
+
+	bodySize := res.ContentLength
+	if bodySize < 0 {
+		bodySize = -1
+	}
+
+	connect := harMillis(t.connectStart, t.connectDone)
+	ssl := harMillis(t.tlsStart, t.tlsDone)
+	// the har connect phase includes the tls handshake
+	if connect >= 0 && ssl >= 0 {
+		connect += ssl
+	}
+
+	entry := harEntry{
+		StartedDateTime: t.start.Format(time.RFC3339Nano),
+		Time:            harMillis(t.start, t.end),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.Header),
+			QueryString: query,
+			HeadersSize: -1,
+			BodySize:    req.ContentLength,
+		},
+		Response: harResponse{
+			Status:      res.StatusCode,
+			StatusText:  http.StatusText(res.StatusCode),
+			HTTPVersion: res.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(res.Header),
+			Content: harContent{
+				Size:     len(b),
+				MimeType: res.Header.Get("Content-Type"),
+				Text:     base64.StdEncoding.EncodeToString(b),
+				Encoding: "base64",
+			},
+			RedirectURL: res.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    bodySize,
+		},
+		Timings: harTimings{
+			Blocked: -1,
+			DNS:     harMillis(t.dnsStart, t.dnsDone),
+			Connect: connect,
+			Send:    harPhase(t.gotConnAt, t.wroteRequest),
+			Wait:    harPhase(t.wroteRequest, t.firstByte),
+			Receive: harPhase(t.firstByte, t.end),
+			SSL:     ssl,
+		},
+	}
+	if len(b) == 0 {
+		entry.Response.Content.Encoding = ""
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entry)
+}
+
+// write writes the recorded entries to path as a HAR file
+func (h *harRecorder) write(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.entries
+	if entries == nil {
+		entries = []harEntry{}
+	}
+
+	b, err := json.MarshalIndent(harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "headers_tester client", Version: version.Get().Version},
+		Entries: entries,
+	}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
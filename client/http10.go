@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+)
+
+// doHttp10 sends req as an HTTP/1.0 request over a new connection. net/http always writes
+// HTTP/1.1 requests, so the request line and headers are written by hand.
+func doHttp10(client *http.Client, req *http.Request) (*http.Response, error) {
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), map[string]string{"http": "80", "https": "443"}[req.URL.Scheme])
+	}
+
+	var conn net.Conn
+	var err error
+	if req.URL.Scheme == "https" {
+		conn, err = dialTLSContext(req.Context(), "tcp", addr, transportTLSConfig(client))
+	} else {
+		conn, err = dialContext(req.Context(), "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.0\r\n", req.Method, req.URL.RequestURI())
+	fmt.Fprintf(&buf, "Host: %s\r\n", req.URL.Host)
+	if err = req.Header.Write(&buf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if len(body) > 0 {
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n", len(body))
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	if _, err = conn.Write(buf.Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	fmt.Println("response protocol:", res.Proto)
+	fmt.Println("connection close:", res.Close)
+	if len(res.TransferEncoding) > 0 {
+		fmt.Println("unexpected transfer-encoding in HTTP/1.0 response:", res.TransferEncoding)
+	}
+
+	res.Body = &connClosingBody{ReadCloser: res.Body, conn: conn}
+	return res, nil
+}
+
+// connClosingBody closes the underlying connection along with the response body
+type connClosingBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b *connClosingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if cerr := b.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// offeredProtocols returns the alpn protocols the client's transport offers during tls handshakes
+func offeredProtocols(client *http.Client) []string {
+	switch t := client.Transport.(type) {
+	case *http.Transport:
+		if t.ForceAttemptHTTP2 {
+			return []string{"h2", "http/1.1"}
+		}
+		if t.TLSClientConfig != nil {
+			return t.TLSClientConfig.NextProtos
+		}
+	case *http2.Transport:
+		protos := []string{http2.NextProtoTLS}
+		if t.TLSClientConfig != nil {
+			for _, proto := range t.TLSClientConfig.NextProtos {
+				if proto != http2.NextProtoTLS {
+					protos = append(protos, proto)
+				}
+			}
+		}
+		return protos
+	}
+	return nil
+}
+
+func transportTLSConfig(client *http.Client) *tls.Config {
+	switch t := client.Transport.(type) {
+	case *http.Transport:
+		return t.TLSClientConfig
+	case *http2.Transport:
+		return t.TLSClientConfig
+	}
+	return nil
+}
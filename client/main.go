@@ -8,27 +8,104 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"github.com/dolthub/headers_tester/version"
 	"golang.org/x/net/http2"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	neturl "net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 var host = flag.String("host", "", "host of server")
 var port = flag.Int("port", 0, "port of server")
-var withHeader = flag.String("header", "", "header used for request, ie 'Range: bytes=0-100'")
+var withHeaders headerFlags
+var resolves headerFlags
 var withParams = flag.String("params", "", "url encoded query params used for request, ie 'range=bytes%3D0%2D100'")
 var allContents = flag.Bool("all", false, "request all contents")
 var verbose = flag.Bool("verbose", false, "log verbosely")
 var useHttp2 = flag.Bool("http2", false, "use http2")
+var httpVersion = flag.String("http-version", "1.1", "http/1.x version used for requests, 1.0 or 1.1")
 var insecure = flag.Bool("tls-skip-verify", false, "tls skip verify")
 var certFile = flag.String("tls-cert-file", "", "path to tls cert file")
 var keyFile = flag.String("tls-key-file", "", "path to tls key file")
+var tlsServerName = flag.String("tls-servername", "", "server name sent in the tls handshake and used to verify the server certificate, instead of the host")
+var withBatch = flag.String("batch", "", "comma separated offset:length ranges posted to /batch, ie '0:100,2500:100'")
+var timing = flag.Bool("timing", false, "print the min, median, p90, p99 and max latency of the sample requests once they complete")
+var traceConns = flag.Bool("trace", false, "log dns, connect and tls handshake timings for each request")
+var echo = flag.Bool("echo", false, "request /echo and print the request as received by the server")
+var acceptEncoding = flag.String("accept-encoding", "", "Accept-Encoding header sent with requests, ie 'br, gzip;q=0.5'. Encoded full content responses are decoded")
+var retries = flag.Int("retries", 0, "number of times a request is retried after a 5xx response")
+var parallelFetch = flag.Int("parallel-fetch", 0, "fetch the contents as this many concurrent range requests and verify the reassembled result")
+var ifMatch = flag.String("if-match", "", "If-Match header sent with requests, ie '\"abc\"' or '*'. Responses are checked for a 412 when the etag does not match")
+var ifNoneMatch = flag.String("if-none-match", "", "If-None-Match header sent with requests. Responses are checked for a 304 only when the etag matches")
+var replay = flag.String("replay", "", "file of requests to replay, one 'METHOD /path | Name: value' request per line")
+var replayConcurrency = flag.Int("replay-concurrency", 1, "number of --replay requests sent concurrently, 1 replays them in order")
+var reportOut = flag.String("report", "", "csv file a row is written to for each request, with its time, method, range, status, bytes and latency")
+var harOut = flag.String("har", "", "file the requests and responses are written to in HTTP Archive (HAR) format")
+var checkOCSP = flag.Bool("check-ocsp", false, "report whether https responses came over a connection with a stapled OCSP response, and summarize it")
+var teTrailers = flag.Bool("te-trailers", false, "send 'TE: trailers' and check the server sends a body digest trailer only when asked")
+var fuzz = flag.Bool("fuzz", false, "send malformed range headers and flag any answered with a 5xx or not answered in time")
+var fuzzTimeout = flag.Duration("fuzz-timeout", 5*time.Second, "time each --fuzz request may take before it is flagged as hanging")
+var ifRangeMatrix = flag.Bool("if-range-matrix", false, "check range requests with matching and non-matching If-Range etags and dates")
+var ifRangeDate = flag.Bool("if-range-date", false, "check range requests with If-Range dates equal to and newer than Last-Modified get 206, and older ones 200")
+var assertNoBody = flag.Bool("assert-no-body", false, "send a HEAD and a conditional GET expecting 304, and fail if any HEAD, 204 or 304 response carries a body")
+var expectAcceptRanges = flag.String("accept-ranges", "bytes", "Accept-Ranges value content responses are expected to carry, flagging its absence. Empty disables the check")
+var sizePreset = flag.String("size", "", "request the server's built in small (1KB), medium (1MB) or large (100MB) content instead of its default content")
+var firstLast = flag.Bool("first-last-probe", false, "send the 'bytes=0-0,-1' probe download managers use to learn an object's size, and check the multipart response holds exactly the first and last byte")
+var checkTotal = flag.Bool("check-total", false, "check the total size claimed in Content-Range against the content actually served")
+var urlEncodeHeaders = flag.Bool("url-encode-headers", false, "url encode the values of --header ranges, as buggy clients do, and check the server rejects them with 400")
+var pipeline = flag.Int("pipeline", 0, "write this many range requests back to back over one connection before reading the responses, and check they arrive in order")
+var measureThroughput = flag.Int("measure-throughput", 0, "download the full content this many times, streaming the bodies, and report the throughput of each attempt and overall")
+var throughputPath = flag.String("throughput-path", "", "path and query appended to the url downloaded by --measure-throughput, ie '/slow?bps=65536'")
+var minReuseRatio = flag.Float64("min-reuse-ratio", 0, "fail unless at least this fraction, between 0 and 1, of the connections obtained for requests were reused. 0 disables the check")
+var rangeTrailer = flag.Bool("range-trailer", false, "send the Range in a request trailer instead of a header and check the server ignores it")
+var upload = flag.Int("upload", 0, "PUT this many bytes to /upload with 'Expect: 100-continue' and report whether 100 continue arrived before the body was sent")
+var compareHost = flag.String("compare-host", "", "host of a second server sent the sample requests, reporting any differences from --host")
+var comparePort = flag.Int("compare-port", 0, "port of the --compare-host server")
+var verifyPattern = flag.Bool("verify-pattern", false, "verify response bodies byte for byte against the content of a server run with --pattern-size")
+var patternSeed = flag.Int64("pattern-seed", 0, "seed the server's --pattern-size content was generated from, for --verify-pattern")
+var doltAuth = flag.String("dolt-auth", "", "token sent with requests in an X-Dolt-Auth header")
+var idempotencyKey = flag.String("idempotency-key", "", "Idempotency-Key header sent with requests, repeated requests with the key are answered with a replayed response")
+var printVersion = flag.Bool("version", false, "print version information and exit")
+
+func init() {
+	flag.Var(&withHeaders, "header", "header used for request, ie 'Range: bytes=0-100'. May be repeated")
+	flag.Var(&resolves, "resolve", "host:port:ip dialed instead of resolving host, ie 'example.com:443:10.0.0.2'. May be repeated")
+}
+
+// headerFlags collects the values of a repeated flag
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
 
 const contentMax = 4000
 
+// sizePresets are the sizes of the server's built in content targeted by --size
+var sizePresets = map[string]int64{
+	"small":  1 << 10,
+	"medium": 1 << 20,
+	"large":  100 << 20,
+}
+
+// knownContentSize is the size of the content requested, the built in content unless --size targets a preset
+func knownContentSize() int64 {
+	if size, ok := sizePresets[*sizePreset]; ok {
+		return size
+	}
+	return contentMax
+}
+
 var sampleRangeStart = "bytes=0-1000"
 var sampleRangeMid = "bytes=2500-2599"
 var sampleRangeEnd = "bytes=-80"
@@ -39,6 +116,9 @@ var sampleRanges = map[string]int{
 	sampleRangeEnd:   80,
 }
 
+var sampleDoltSuffix = "-80"
+var sampleDoltSuffixLen = 80
+
 var sampleParamsStart = "range=bytes%3D0%2D1000"
 var sampleParamsMid = "range=bytes%3D2500%2D2599"
 var sampleParamsEnd = "range=bytes%3D%2D80"
@@ -51,6 +131,10 @@ var sampleParams = map[string]int{
 
 func main() {
 	flag.Parse()
+	if *printVersion {
+		version.Print("client")
+		return
+	}
 	if *host == "" {
 		fmt.Println("must supply --host")
 		os.Exit(1)
@@ -60,30 +144,145 @@ func main() {
 		os.Exit(1)
 	}
 
-	url := fmt.Sprintf("http://%s:%d", *host, *port)
-	client := getDefaultClient(*useHttp2)
+	if *httpVersion != "1.0" && *httpVersion != "1.1" {
+		fmt.Println("--http-version must be 1.0 or 1.1")
+		os.Exit(1)
+	}
+	if *httpVersion == "1.0" && *useHttp2 {
+		fmt.Println("--http-version 1.0 can't be used with --http2")
+		os.Exit(1)
+	}
+	if *replayConcurrency < 1 {
+		fmt.Println("--replay-concurrency must be at least 1")
+		os.Exit(1)
+	}
+	if *upload < 0 {
+		fmt.Println("--upload must not be negative")
+		os.Exit(1)
+	}
+	if *minReuseRatio < 0 || *minReuseRatio > 1 {
+		fmt.Println("--min-reuse-ratio must be between 0 and 1")
+		os.Exit(1)
+	}
+	if *measureThroughput < 0 {
+		fmt.Println("--measure-throughput must not be negative")
+		os.Exit(1)
+	}
+	if *pipeline < 0 {
+		fmt.Println("--pipeline must not be negative")
+		os.Exit(1)
+	}
+	if *parallelFetch < 0 {
+		fmt.Println("--parallel-fetch must not be negative")
+		os.Exit(1)
+	}
+
+	if _, ok := sizePresets[*sizePreset]; *sizePreset != "" && !ok {
+		fmt.Println("--size must be small, medium or large")
+		os.Exit(1)
+	}
+
+	if *compareHost != "" && *comparePort == 0 {
+		fmt.Println("must supply --compare-port with --compare-host")
+		os.Exit(1)
+	}
 
 	var err error
-	if *insecure && *certFile == "" && *keyFile == "" {
-		url, client, err = skipVerifyUrlAndClient(*host, *port, *useHttp2)
-	} else if *certFile != "" && *keyFile != "" {
-		url, client, err = secureUrlAndClient(*host, *certFile, *keyFile, *port, *useHttp2)
+	resolveOverrides, err = parseResolve(resolves)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
 	}
+
+	url, client, err := urlAndClient(*host, *port)
 	if err != nil {
-		panic(err)
+		exitWithError(err)
+	}
+
+	if *reportOut != "" {
+		report, err = openReport(*reportOut)
+		if err != nil {
+			exitWithError(err)
+		}
+		defer closeReport()
+	}
+
+	if *compareHost != "" {
+		compareUrl, compareClient, err := urlAndClient(*compareHost, *comparePort)
+		if err != nil {
+			exitWithError(err)
+		}
+		err = sendComparison(client, url, compareClient, compareUrl, *verbose)
+		if err != nil {
+			exitWithError(err)
+		}
+		return
 	}
 
-	if *withHeader != "" {
-		_, _, err = sendWithHeader(client, url, *withHeader, *verbose)
-	} else if *withParams != "" {
-		_, _, err = sendWithParams(client, url, *withParams, *verbose)
-	} else if *allContents {
-		_, _, err = sendRaw(client, url, *verbose)
+	// presets target the server's built in sized content instead of /
+	contentUrl := url
+	if *sizePreset != "" {
+		contentUrl = url + "/" + *sizePreset
+	}
+
+	if len(withHeaders) > 0 || *withParams != "" {
+		_, _, err = sendWithHeadersAndParams(client, contentUrl, withHeaders, *withParams, *verbose)
+	} else if *withBatch != "" {
+		err = sendBatch(client, url, *withBatch, *verbose)
+	} else if *ifRangeMatrix {
+		err = sendIfRangeMatrix(client, contentUrl, *verbose)
+	} else if *ifRangeDate {
+		err = sendIfRangeDate(client, contentUrl, *verbose)
+	} else if *upload > 0 {
+		err = sendUpload(client, url, *upload, *verbose)
+	} else if *measureThroughput > 0 {
+		throughputUrl := contentUrl
+		if *throughputPath != "" {
+			throughputUrl = url + *throughputPath
+		}
+		err = sendThroughput(client, throughputUrl, *measureThroughput, *verbose)
+	} else if *pipeline > 0 {
+		err = sendPipelined(client, contentUrl, *pipeline, *verbose)
+	} else if *rangeTrailer {
+		err = sendRangeTrailer(client, contentUrl, *verbose)
+	} else if *assertNoBody {
+		err = sendNoBodyChecks(client, contentUrl, *verbose)
+	} else if *firstLast {
+		err = sendFirstLastProbe(client, contentUrl, *verbose)
+	} else if *checkTotal {
+		err = sendTotalCheck(client, contentUrl, *verbose)
+	} else if *fuzz {
+		err = sendFuzz(client, contentUrl, knownContentSize(), *fuzzTimeout, *verbose)
+	} else if *replay != "" {
+		err = sendReplay(client, url, *replay, *replayConcurrency, *verbose)
+	} else if *parallelFetch > 0 {
+		err = sendParallel(client, contentUrl, *parallelFetch, *verbose)
+	} else if *echo {
+		err = sendEcho(client, url, *verbose)
+	} else if *allContents || *sizePreset != "" {
+		// the sample ranges assume the built in content, so presets fetch all content by default
+		_, _, err = sendRaw(client, contentUrl, *verbose)
 	} else {
 		err = sendSamples(client, url, *verbose)
 	}
 	if err != nil {
-		panic(err)
+		exitWithError(err)
+	}
+
+	if *harOut != "" {
+		if err = har.write(*harOut); err != nil {
+			exitWithError(err)
+		}
+		fmt.Println("wrote har:", *harOut)
+	}
+
+	// report rows are flushed as they are written, so exiting here loses none
+	if *minReuseRatio > 0 && !connReuse.meetsRatio(*minReuseRatio) {
+		os.Exit(1)
+	}
+	if *assertNoBody && bodyViolations.Load() > 0 {
+		fmt.Println("responses carried a body where none is allowed:", bodyViolations.Load())
+		os.Exit(1)
 	}
 }
 
@@ -118,6 +317,19 @@ func sendSamples(client *http.Client, url string, vbs bool) error {
 		}
 	}
 
+	// request the last bytes with the bare suffix form dolt clients send in x-dolt-range
+	header := "x-dolt-range: " + sampleDoltSuffix
+	actualStatus, actualLen, err := sendWithHeader(client, url, header, vbs)
+	if err != nil {
+		return err
+	}
+	if actualStatus != http.StatusPartialContent {
+		fmt.Printf("did not receive expected status: url: %s header: %s expected: %d actual: %d", url, header, http.StatusPartialContent, actualStatus)
+	}
+	if actualLen != sampleDoltSuffixLen {
+		fmt.Printf("requested bytes did not match bytes served: url: %s header: %s requested: %d served: %d", url, header, sampleDoltSuffixLen, actualLen)
+	}
+
 	// request ranges with params
 	for params, expectedLen := range sampleParams {
 		actualStatus, actualLen, err := sendWithParams(client, url, params, vbs)
@@ -133,7 +345,7 @@ func sendSamples(client *http.Client, url string, vbs bool) error {
 	}
 
 	// request all contents
-	actualStatus, actualLen, err := sendRaw(client, url, vbs)
+	actualStatus, actualLen, err = sendRaw(client, url, vbs)
 	if err != nil {
 		return err
 	}
@@ -144,6 +356,12 @@ func sendSamples(client *http.Client, url string, vbs bool) error {
 		fmt.Printf("requested bytes did not match bytes served: url: %s requested: %d served: %d", url, contentMax, actualLen)
 	}
 
+	reused, conns := connReuse.counts()
+	fmt.Printf("connections reused: %d of %d\n", reused, conns)
+	if *timing {
+		requestLatencies.printPercentiles()
+	}
+
 	return nil
 }
 
@@ -156,7 +374,7 @@ func sendRaw(client *http.Client, url string, vbs bool) (int, int, error) {
 }
 
 func sendWithParams(client *http.Client, url, params string, vbs bool) (int, int, error) {
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/?%s", url, params), http.NoBody)
+	req, err := http.NewRequest(http.MethodGet, withQuery(url, params), http.NoBody)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -164,28 +382,147 @@ func sendWithParams(client *http.Client, url, params string, vbs bool) (int, int
 }
 
 func sendWithHeader(client *http.Client, url, header string, vbs bool) (int, int, error) {
-	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	return sendWithHeadersAndParams(client, url, []string{header}, "", vbs)
+}
+
+// sendWithHeadersAndParams sends a single request carrying every range header and the url encoded query
+// params. When more than one range is specified, the range the server chose to serve is reported.
+func sendWithHeadersAndParams(client *http.Client, url string, headers []string, params string, vbs bool) (int, int, error) {
+	reqUrl := url
+	if params != "" {
+		reqUrl = withQuery(url, params)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, reqUrl, http.NoBody)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var sources []rangeSource
+	for _, header := range headers {
+		key, value, err := parseRangeHeader(header)
+		if err != nil {
+			return 0, 0, err
+		}
+		if *urlEncodeHeaders {
+			value = neturl.QueryEscape(value)
+		}
+		req.Header.Add(key, value)
+		if strings.EqualFold(key, "X-Dolt-Range") {
+			value = normalizeDoltRange(value)
+		}
+		sources = append(sources, rangeSource{name: key + " header", value: value})
+	}
+
+	for key, values := range req.URL.Query() {
+		for _, value := range values {
+			sources = append(sources, rangeSource{name: key + " query param", value: value})
+		}
+	}
+
+	res, b, err := roundTrip(client, req, vbs)
 	if err != nil {
 		return 0, 0, err
 	}
 
+	if len(sources) > 1 {
+		reportServedRange(sources, res.Header.Get("Content-Range"))
+	}
+	if *urlEncodeHeaders && len(headers) > 0 {
+		if res.StatusCode == http.StatusBadRequest {
+			fmt.Println("server rejected url encoded range header")
+		} else {
+			fmt.Printf("server accepted url encoded range header: expected: %d actual: %d\n", http.StatusBadRequest, res.StatusCode)
+		}
+	}
+	checkBodyLength(sources, res, b)
+	checkRangeStatus(sources, res)
+	checkUnsatisfiable(knownContentSize(), res)
+	checkAcceptRanges(*expectAcceptRanges, res)
+
+	return res.StatusCode, len(b), nil
+}
+
+// withQuery appends url encoded query params to url, requesting the root path when url has no path
+func withQuery(url, params string) string {
+	if u, err := neturl.Parse(url); err == nil && u.Path != "" {
+		return url + "?" + params
+	}
+	return url + "/?" + params
+}
+
+func parseRangeHeader(header string) (string, string, error) {
 	parts := strings.Split(header, ":")
 	if len(parts) != 2 {
-		return 0, 0, errors.New("failed to parse header")
+		return "", "", errors.New("failed to parse header")
 	}
 
 	key := strings.TrimSpace(parts[0])
 	value := strings.TrimSpace(parts[1])
 
 	if key != "Range" && key != "range" && key != "x-dolt-range" && key != "X-Dolt-Range" {
-		return 0, 0, errors.New("unsupported header, only 'Range'|'range' and 'X-Dolt-Range'|'x-dolt-range' supported")
+		return "", "", errors.New("unsupported header, only 'Range'|'range' and 'X-Dolt-Range'|'x-dolt-range' supported")
 	}
 
-	req.Header.Add(key, value)
-	return send(client, req, vbs)
+	return key, value, nil
 }
 
 func send(client *http.Client, req *http.Request, vbs bool) (int, int, error) {
+	res, b, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return 0, 0, err
+	}
+	sources := requestRangeSources(req)
+	checkBodyLength(sources, res, b)
+	checkRangeStatus(sources, res)
+	checkUnsatisfiable(knownContentSize(), res)
+	checkAcceptRanges(*expectAcceptRanges, res)
+	return res.StatusCode, len(b), nil
+}
+
+// roundTrip logs and sends the request, returning the response along with its fully read body.
+// Requests that receive a 5xx response are retried up to --retries times.
+func roundTrip(client *http.Client, req *http.Request, vbs bool) (*http.Response, []byte, error) {
+	for attempt := 1; ; attempt++ {
+		res, b, err := roundTripOnce(client, req, vbs)
+		if err != nil || res.StatusCode < http.StatusInternalServerError || attempt > *retries {
+			return res, b, err
+		}
+
+		fmt.Printf("retrying after status %d: attempt %d of %d\n", res.StatusCode, attempt, *retries)
+		fmt.Println()
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+func roundTripOnce(client *http.Client, req *http.Request, vbs bool) (*http.Response, []byte, error) {
+	// setting Accept-Encoding disables the transport's transparent gzip decoding, bodies are decoded below
+	if *acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", *acceptEncoding)
+	}
+	if *ifMatch != "" {
+		req.Header.Set("If-Match", *ifMatch)
+	}
+	if *ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", *ifNoneMatch)
+	}
+	if *teTrailers {
+		req.Header.Set("TE", "trailers")
+	}
+	if *idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", *idempotencyKey)
+	}
+	if *doltAuth != "" {
+		req.Header.Set("X-Dolt-Auth", *doltAuth)
+	}
+
 	fmt.Println("request:")
 	for name, headers := range req.Header {
 		for _, hdr := range headers {
@@ -198,14 +535,39 @@ func send(client *http.Client, req *http.Request, vbs bool) (int, int, error) {
 	}
 
 	fmt.Println()
-	res, err := client.Do(req)
+
+	if vbs && req.URL.Scheme == "https" && *httpVersion != "1.0" {
+		fmt.Println("alpn offered protocols:", offeredProtocols(client))
+	}
+
+	timings := &requestTimings{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timings.clientTrace()))
+
+	timings.start = time.Now()
+	var res *http.Response
+	var err error
+	if *httpVersion == "1.0" {
+		res, err = doHttp10(client, req)
+	} else {
+		res, err = client.Do(req)
+	}
 	if err != nil {
-		return 0, 0, err
+		return nil, nil, err
 	}
 	defer res.Body.Close()
 
 	fmt.Println("response:")
 	fmt.Println("status:", res.Status)
+	if vbs && res.TLS != nil {
+		negotiated := res.TLS.NegotiatedProtocol
+		if negotiated == "" {
+			negotiated = "none"
+		}
+		fmt.Println("alpn negotiated protocol:", negotiated)
+	}
+	if *checkOCSP && req.URL.Scheme == "https" {
+		printOCSPStaple(res.TLS)
+	}
 	for name, headers := range res.Header {
 		for _, hdr := range headers {
 			fmt.Printf("with header: '%s: %s'\n", name, hdr)
@@ -214,20 +576,87 @@ func send(client *http.Client, req *http.Request, vbs bool) (int, int, error) {
 
 	b, err := io.ReadAll(res.Body)
 	if err != nil {
-		return 0, 0, err
+		return nil, nil, err
+	}
+	timings.end = time.Now()
+	if *timing {
+		requestLatencies.record(timings.end.Sub(timings.start))
+	}
+
+	// trailers are only available once the body is read, and digest the body as sent
+	checkTrailers(*teTrailers, res, b)
+
+	// ranges of encoded content are fragments of the encoded representation, so only complete bodies are decoded
+	if ce := res.Header.Get("Content-Encoding"); ce != "" && res.StatusCode == http.StatusOK {
+		wireLen := len(b)
+		b, err = decodeBody(ce, b)
+		if err != nil {
+			return nil, nil, err
+		}
+		fmt.Println("decoded content-encoding:", ce)
+		if vbs {
+			printCompression(ce, wireLen, len(b))
+		}
+	} else if vbs && res.Uncompressed {
+		// the transport removes Content-Encoding from bodies it decompresses itself, hiding the wire size
+		fmt.Println("compression: gzip decoded by transport, wire bytes unknown")
 	}
 
 	if vbs {
 		fmt.Println("body (base64):", base64.StdEncoding.EncodeToString(b))
 		fmt.Println()
+		timings.printLatency()
+		printServerTiming(res.Header)
+	}
+
+	if *harOut != "" {
+		har.record(req, res, b, timings)
+	}
+	report.record(req, res, b, timings)
+
+	if *verifyPattern {
+		verifyPatternBody(*patternSeed, res, b)
+	}
+	if *idempotencyKey != "" {
+		fmt.Println("idempotent replay:", res.Header.Get("Idempotency-Replayed") == "true")
+	}
+	if *ifMatch != "" {
+		checkIfMatch(*ifMatch, res)
+	}
+	if *ifNoneMatch != "" {
+		checkIfNoneMatch(*ifNoneMatch, res)
+	}
+	if *assertNoBody {
+		checkNoBody(req, res, b)
+	}
+
+	timings.printReuse()
+	if *traceConns {
+		timings.printConnection()
 	}
 
 	fmt.Println()
-	return res.StatusCode, len(b), nil
+	return res, b, nil
+}
+
+// urlAndClient returns the base url of the server at host and port, and a client for it configured by
+// the protocol and tls flags
+func urlAndClient(host string, port int) (string, *http.Client, error) {
+	if *insecure && *certFile == "" && *keyFile == "" {
+		return skipVerifyUrlAndClient(host, port, *tlsServerName, *useHttp2)
+	} else if *certFile != "" && *keyFile != "" {
+		return secureUrlAndClient(host, *certFile, *keyFile, port, *tlsServerName, *useHttp2)
+	}
+	return fmt.Sprintf("http://%s:%d", host, port), getDefaultClient(*useHttp2), nil
 }
 
 func getDefaultClient(useHttp2 bool) *http.Client {
 	client := http.DefaultClient
+	if len(resolveOverrides) > 0 {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.DialContext = dialContext
+		client = &http.Client{Transport: t}
+	}
 	if useHttp2 {
 		client = &http.Client{
 			Transport: &http2.Transport{
@@ -235,17 +664,18 @@ func getDefaultClient(useHttp2 bool) *http.Client {
 				AllowHTTP: true,
 				// Pretend we are dialing a TLS endpoint. (Note, we ignore the passed tls.Config)
 				DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
-					return net.Dial(network, addr)
+					return dialContext(ctx, network, addr)
 				},
 			},
 		}
 	}
 	return client
 }
-func skipVerifyUrlAndClient(host string, port int, useHttp2 bool) (string, *http.Client, error) {
+func skipVerifyUrlAndClient(host string, port int, serverName string, useHttp2 bool) (string, *http.Client, error) {
 	url := fmt.Sprintf("https://%s:%d", host, port)
 	t := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: serverName},
+		DialContext:     dialContext,
 	}
 
 	client := &http.Client{Transport: t}
@@ -253,7 +683,8 @@ func skipVerifyUrlAndClient(host string, port int, useHttp2 bool) (string, *http
 	if useHttp2 {
 		client = &http.Client{
 			Transport: &http2.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: serverName},
+				DialTLSContext:  dialTLSContext,
 			},
 		}
 	}
@@ -261,7 +692,7 @@ func skipVerifyUrlAndClient(host string, port int, useHttp2 bool) (string, *http
 	return url, client, nil
 }
 
-func secureUrlAndClient(host, certFile, keyFile string, port int, useHttp2 bool) (string, *http.Client, error) {
+func secureUrlAndClient(host, certFile, keyFile string, port int, serverName string, useHttp2 bool) (string, *http.Client, error) {
 	url := fmt.Sprintf("https://%s:%d", host, port)
 
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
@@ -281,7 +712,9 @@ func secureUrlAndClient(host, certFile, keyFile string, port int, useHttp2 bool)
 		TLSClientConfig: &tls.Config{
 			Certificates: []tls.Certificate{cert},
 			RootCAs:      caCertPool,
+			ServerName:   serverName,
 		},
+		DialContext: dialContext,
 	}}
 
 	if useHttp2 {
@@ -290,7 +723,9 @@ func secureUrlAndClient(host, certFile, keyFile string, port int, useHttp2 bool)
 				TLSClientConfig: &tls.Config{
 					Certificates: []tls.Certificate{cert},
 					RootCAs:      caCertPool,
+					ServerName:   serverName,
 				},
+				DialTLSContext: dialTLSContext,
 			},
 		}
 	}
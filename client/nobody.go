@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// bodyViolations counts responses checked by --assert-no-body that carried a body the spec forbids
+var bodyViolations atomic.Int64
+
+// bodyForbidden reports whether a response to req with status must not carry a body, see RFC 9110
+// sections 9.3.2, 15.3.5 and 15.4.5
+func bodyForbidden(method string, status int) bool {
+	return method == http.MethodHead || status == http.StatusNoContent || status == http.StatusNotModified
+}
+
+// checkNoBody asserts responses to HEAD requests and 204 and 304 responses have empty bodies, and that 204
+// responses don't declare one with a Content-Length
+func checkNoBody(req *http.Request, res *http.Response, b []byte) {
+	if !bodyForbidden(req.Method, res.StatusCode) {
+		return
+	}
+
+	if len(b) > 0 {
+		bodyViolations.Add(1)
+		fmt.Printf("received a body where none is allowed: method: %s status: %d bytes: %d\n", req.Method, res.StatusCode, len(b))
+		return
+	}
+	if cl := res.Header.Get("Content-Length"); res.StatusCode == http.StatusNoContent && cl != "" && cl != "0" {
+		bodyViolations.Add(1)
+		fmt.Printf("204 response declared a body: content-length: %s\n", cl)
+		return
+	}
+	fmt.Printf("no body as expected: method: %s status: %d\n", req.Method, res.StatusCode)
+}
+
+// sendNoBodyChecks sends a HEAD request for the content, then a GET with its ETag in If-None-Match, for
+// checkNoBody to assert neither response carried a body
+func sendNoBodyChecks(client *http.Client, url string, vbs bool) error {
+	req, err := http.NewRequest(http.MethodHead, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	res, _, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return err
+	}
+
+	etag := res.Header.Get("ETag")
+	if etag == "" {
+		fmt.Println("head response is missing etag, not sending conditional request")
+		return nil
+	}
+
+	req, err = http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("If-None-Match", etag)
+
+	res, _, err = roundTrip(client, req, vbs)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusNotModified {
+		fmt.Printf("conditional request was not answered with 304: status: %d\n", res.StatusCode)
+	}
+
+	return nil
+}
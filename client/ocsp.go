@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+var ocspStatusNames = map[int]string{
+	ocsp.Good:    "good",
+	ocsp.Revoked: "revoked",
+	ocsp.Unknown: "unknown",
+}
+
+// printOCSPStaple reports whether the server stapled an OCSP response to the tls handshake, and
+// summarizes it if so
+func printOCSPStaple(state *tls.ConnectionState) {
+	if state == nil {
+		fmt.Println("ocsp staple: not a tls connection")
+		return
+	}
+	if len(state.OCSPResponse) == 0 {
+		fmt.Println("ocsp staple: none")
+		return
+	}
+
+	var leaf, issuer *x509.Certificate
+	if len(state.PeerCertificates) > 0 {
+		leaf = state.PeerCertificates[0]
+	}
+	if len(state.PeerCertificates) > 1 {
+		issuer = state.PeerCertificates[1]
+	}
+
+	res, err := ocsp.ParseResponseForCert(state.OCSPResponse, leaf, issuer)
+	if err != nil {
+		fmt.Println("ocsp staple: failed to parse:", err.Error())
+		return
+	}
+
+	fmt.Println("ocsp staple: present")
+	fmt.Println("ocsp status:", ocspStatusNames[res.Status])
+	fmt.Println("ocsp produced at:", res.ProducedAt.Format(time.RFC3339))
+	fmt.Println("ocsp this update:", res.ThisUpdate.Format(time.RFC3339))
+	if !res.NextUpdate.IsZero() {
+		fmt.Println("ocsp next update:", res.NextUpdate.Format(time.RFC3339))
+		if time.Now().After(res.NextUpdate) {
+			fmt.Println("ocsp staple has expired")
+		}
+	}
+	if res.Status == ocsp.Revoked {
+		fmt.Println("ocsp revoked at:", res.RevokedAt.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// fetchedRange is the result of fetching a single range of a parallel fetch
+type fetchedRange struct {
+	first int64
+	last  int64
+	body  []byte
+	err   error
+}
+
+// splitRanges splits content of the given size into n contiguous ranges of roughly equal length
+func splitRanges(size int64, n int) []fetchedRange {
+	if int64(n) > size {
+		n = int(size)
+	}
+
+	chunk := (size + int64(n) - 1) / int64(n)
+	var ranges []fetchedRange
+	for first := int64(0); first < size; first += chunk {
+		last := first + chunk - 1
+		if last >= size {
+			last = size - 1
+		}
+		ranges = append(ranges, fetchedRange{first: first, last: last})
+	}
+	return ranges
+}
+
+// sendParallel fetches the full content, then fetches it again as n concurrent range requests, verifying
+// the Content-Range of each part and that the reassembled parts match the full content.
+func sendParallel(client *http.Client, url string, n int, vbs bool) error {
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	res, expected, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		fmt.Printf("did not receive expected status: url: %s expected: %d actual: %d\n", url, http.StatusOK, res.StatusCode)
+		return nil
+	}
+	if len(expected) == 0 {
+		fmt.Println("no content to fetch in parallel")
+		return nil
+	}
+
+	ranges := splitRanges(int64(len(expected)), n)
+
+	var wg sync.WaitGroup
+	for i := range ranges {
+		wg.Add(1)
+		go func(rng *fetchedRange) {
+			defer wg.Done()
+			rng.body, rng.err = fetchRange(client, url, rng.first, rng.last, int64(len(expected)), vbs)
+		}(&ranges[i])
+	}
+	wg.Wait()
+
+	var reassembled []byte
+	for i, rng := range ranges {
+		if rng.err != nil {
+			return fmt.Errorf("failed to fetch part %d bytes=%d-%d: %w", i, rng.first, rng.last, rng.err)
+		}
+		reassembled = append(reassembled, rng.body...)
+	}
+
+	fmt.Println("parallel fetch:")
+	fmt.Printf("fetched %d ranges of %d bytes\n", len(ranges), len(expected))
+	if bytes.Equal(reassembled, expected) {
+		fmt.Println("reassembled content matches full content")
+	} else {
+		fmt.Printf("reassembled content did not match full content: expected: %d bytes reassembled: %d bytes\n", len(expected), len(reassembled))
+	}
+
+	reused, conns := connReuse.counts()
+	fmt.Printf("connections reused: %d of %d\n", reused, conns)
+	fmt.Println()
+
+	return nil
+}
+
+// fetchRange requests the bytes first through last, returning an error if the response is not a 206
+// with a Content-Range and body matching the requested range.
+func fetchRange(client *http.Client, url string, first, last, size int64, vbs bool) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+
+	res, b, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("did not receive expected status: expected: %d actual: %d", http.StatusPartialContent, res.StatusCode)
+	}
+
+	contentRange := res.Header.Get("Content-Range")
+	servedFirst, servedLast, servedSize, err := parseContentRange(contentRange)
+	if err != nil {
+		return nil, err
+	}
+	if servedFirst != first || servedLast != last || servedSize != size {
+		return nil, fmt.Errorf("did not receive expected content-range: expected: 'bytes %d-%d/%d' actual: '%s'", first, last, size, contentRange)
+	}
+	if int64(len(b)) != last-first+1 {
+		return nil, fmt.Errorf("requested bytes did not match bytes served: requested: %d served: %d", last-first+1, len(b))
+	}
+
+	return b, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+)
+
+// pipelineRanges are requested in turn by --pipeline, their differing lengths reveal responses served out of order
+var pipelineRanges = []string{sampleRangeStart, sampleRangeMid, sampleRangeEnd}
+
+// sendPipelined writes n range requests back to back over a single connection before reading any response,
+// then reads the responses and checks they arrive in request order. net/http never pipelines, so the requests
+// are written by hand.
+func sendPipelined(client *http.Client, url string, n int, vbs bool) error {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return err
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), map[string]string{"http": "80", "https": "443"}[u.Scheme])
+	}
+
+	var conn net.Conn
+	if u.Scheme == "https" {
+		// pipelining only exists in http/1.1, so h2 is not offered
+		cfg := &tls.Config{}
+		if tc := transportTLSConfig(client); tc != nil {
+			cfg = tc.Clone()
+		}
+		cfg.NextProtos = []string{"http/1.1"}
+		conn, err = dialTLSContext(context.Background(), "tcp", addr, cfg)
+	} else {
+		conn, err = dialContext(context.Background(), "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var buf bytes.Buffer
+	reqs := make([]*http.Request, n)
+	for i := range reqs {
+		req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Range", pipelineRanges[i%len(pipelineRanges)])
+		reqs[i] = req
+
+		fmt.Fprintf(&buf, "GET %s HTTP/1.1\r\n", u.RequestURI())
+		fmt.Fprintf(&buf, "Host: %s\r\n", u.Host)
+		if err = req.Header.Write(&buf); err != nil {
+			return err
+		}
+		buf.WriteString("\r\n")
+	}
+
+	fmt.Println("pipelining requests:", n)
+	if _, err = conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	inOrder := 0
+	br := bufio.NewReader(conn)
+	for i, req := range reqs {
+		rangeStr := req.Header.Get("Range")
+		res, err := http.ReadResponse(br, req)
+		if err != nil {
+			return fmt.Errorf("failed to read pipelined response %d of %d: %w", i+1, n, err)
+		}
+		b, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read pipelined response %d of %d: %w", i+1, n, err)
+		}
+
+		fmt.Printf("response %d: range: %s status: %d content-range: '%s' bytes: %d\n",
+			i+1, rangeStr, res.StatusCode, res.Header.Get("Content-Range"), len(b))
+		if vbs {
+			fmt.Println("body (base64):", base64.StdEncoding.EncodeToString(b))
+		}
+
+		expectedLen := sampleRanges[rangeStr]
+		switch {
+		case res.StatusCode != http.StatusPartialContent:
+			fmt.Printf("did not receive expected status: expected: %d actual: %d\n", http.StatusPartialContent, res.StatusCode)
+		case len(b) != expectedLen:
+			fmt.Printf("response out of order or wrong length: requested: %d served: %d\n", expectedLen, len(b))
+		default:
+			inOrder++
+		}
+
+		// a server that doesn't pipeline closes the connection after the response it chose to answer
+		if res.Close && i < n-1 {
+			fmt.Printf("server closed the connection after %d of %d pipelined requests\n", i+1, n)
+			break
+		}
+	}
+
+	fmt.Printf("pipelined responses received in order: %d of %d\n", inOrder, n)
+	fmt.Println()
+	return nil
+}
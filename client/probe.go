@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+// firstLastProbe is the range download managers send to fetch the first and last byte of an object, learning
+// its size from the Content-Range of either part
+const firstLastProbe = "bytes=0-0,-1"
+
+// sendFirstLastProbe requests the first and last byte in one multi-range request, and checks the response is
+// a multipart/byteranges body of exactly those two bytes, with each part's Content-Range agreeing on the total
+// size.
+func sendFirstLastProbe(client *http.Client, url string, vbs bool) error {
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", firstLastProbe)
+
+	res, b, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("first and last byte probe:")
+	defer fmt.Println()
+
+	if res.StatusCode != http.StatusPartialContent {
+		fmt.Printf("did not receive expected status: expected: %d actual: %d\n", http.StatusPartialContent, res.StatusCode)
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		// a one byte object has the same first and last byte, which a server may answer as a single range
+		first, last, size, err := parseContentRange(res.Header.Get("Content-Range"))
+		if err == nil && first == 0 && last == 0 && size == 1 {
+			fmt.Println("single range for one byte object, learned size: 1")
+			return nil
+		}
+		fmt.Printf("expected multipart/byteranges response: content-type: '%s' content-range: '%s'\n", res.Header.Get("Content-Type"), res.Header.Get("Content-Range"))
+		return nil
+	}
+
+	var ranges [][3]int64
+	mr := multipart.NewReader(bytes.NewReader(b), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		partBytes, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+
+		contentRange := part.Header.Get("Content-Range")
+		first, last, size, err := parseContentRange(contentRange)
+		if err != nil {
+			fmt.Printf("part has an invalid content-range: '%s'\n", contentRange)
+			return nil
+		}
+		fmt.Printf("part content-range: %s length: %d\n", contentRange, len(partBytes))
+		if int64(len(partBytes)) != last-first+1 {
+			fmt.Printf("part length did not match its content-range: content-range: %s length: %d\n", contentRange, len(partBytes))
+		}
+		ranges = append(ranges, [3]int64{first, last, size})
+	}
+
+	if len(ranges) != 2 {
+		fmt.Printf("expected 2 parts, received: %d\n", len(ranges))
+		return nil
+	}
+
+	size := ranges[0][2]
+	switch {
+	case ranges[1][2] != size:
+		fmt.Printf("parts disagree on the total size: %d and %d\n", size, ranges[1][2])
+	case ranges[0][0] != 0 || ranges[0][1] != 0:
+		fmt.Printf("first part is not the first byte: bytes %d-%d\n", ranges[0][0], ranges[0][1])
+	case ranges[1][0] != size-1 || ranges[1][1] != size-1:
+		fmt.Printf("second part is not the last byte: bytes %d-%d of %d\n", ranges[1][0], ranges[1][1], size)
+	default:
+		fmt.Println("probe learned size:", size)
+	}
+
+	return nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dolthub/headers_tester/pattern"
+)
+
+var errInvalidRangeStr = errors.New("invalid range string")
+var errInvalidContentRange = errors.New("invalid content range")
+
+// normalizeDoltRange treats the bare suffix form `-N` the server accepts in X-Dolt-Range as `bytes=-N`
+func normalizeDoltRange(rngStr string) string {
+	if strings.HasPrefix(rngStr, "-") {
+		return "bytes=" + rngStr
+	}
+	return rngStr
+}
+
+// rangeBounds returns the first and last byte offsets selected by a range string for content of
+// the given size, following the same rules as the server.
+func rangeBounds(rngStr string, size int64) (int64, int64, error) {
+	if !strings.HasPrefix(rngStr, "bytes=") {
+		return -1, -1, errInvalidRangeStr
+	}
+
+	first, last, ok := strings.Cut(rngStr[6:], "-")
+	if !ok || strings.Contains(last, "-") {
+		return -1, -1, errInvalidRangeStr
+	}
+	first = strings.TrimSpace(first)
+	last = strings.TrimSpace(last)
+
+	// suffix range of the last N bytes `bytes=-#`
+	if first == "" {
+		length, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return -1, -1, errInvalidRangeStr
+		}
+		if length > size {
+			length = size
+		}
+		return size - length, size - 1, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return -1, -1, errInvalidRangeStr
+	}
+
+	// offset to end of content `bytes=#-`
+	if last == "" {
+		return start, size - 1, nil
+	}
+
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return -1, -1, errInvalidRangeStr
+	}
+	return start, end, nil
+}
+
+// parseContentRange parses a Content-Range header of the form `bytes first-last/size`
+func parseContentRange(contentRange string) (int64, int64, int64, error) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return -1, -1, -1, errInvalidContentRange
+	}
+
+	rng, sizeStr, ok := strings.Cut(contentRange[6:], "/")
+	if !ok {
+		return -1, -1, -1, errInvalidContentRange
+	}
+
+	firstStr, lastStr, ok := strings.Cut(rng, "-")
+	if !ok {
+		return -1, -1, -1, errInvalidContentRange
+	}
+
+	first, err := strconv.ParseInt(firstStr, 10, 64)
+	if err != nil {
+		return -1, -1, -1, errInvalidContentRange
+	}
+
+	last, err := strconv.ParseInt(lastStr, 10, 64)
+	if err != nil {
+		return -1, -1, -1, errInvalidContentRange
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return -1, -1, -1, errInvalidContentRange
+	}
+
+	return first, last, size, nil
+}
+
+// rangeSource is a range specification sent with a request, and where it was sent
+type rangeSource struct {
+	name  string
+	value string
+}
+
+// reportServedRange prints which of the range sources sent with a request matches the range
+// the server reported serving in its Content-Range header.
+func reportServedRange(sources []rangeSource, contentRange string) {
+	fmt.Println("range sources:")
+
+	first, last, size, err := parseContentRange(contentRange)
+	if err != nil {
+		fmt.Printf("could not determine served range from content-range: '%s'\n", contentRange)
+		size = contentMax
+	}
+
+	for _, src := range sources {
+		start, end, err := rangeBounds(src.value, size)
+		if err != nil {
+			fmt.Printf("%s '%s': %s\n", src.name, src.value, err.Error())
+			continue
+		}
+
+		served := ""
+		if contentRange != "" && start == first && end == last {
+			served = " (served)"
+		}
+		fmt.Printf("%s '%s': bytes %d-%d%s\n", src.name, src.value, start, end, served)
+	}
+	fmt.Println()
+}
+
+// requestRangeSources returns the range headers and range query params sent with a request
+func requestRangeSources(req *http.Request) []rangeSource {
+	var sources []rangeSource
+	for _, value := range req.Header.Values("Range") {
+		sources = append(sources, rangeSource{name: "Range header", value: value})
+	}
+	for _, value := range req.Header.Values("X-Dolt-Range") {
+		sources = append(sources, rangeSource{name: "X-Dolt-Range header", value: normalizeDoltRange(value)})
+	}
+	for _, value := range req.URL.Query()["range"] {
+		sources = append(sources, rangeSource{name: "range query param", value: value})
+	}
+	return sources
+}
+
+// parseUnsatisfiedContentRange parses the Content-Range header of a 416 response, of the form `bytes */size`
+func parseUnsatisfiedContentRange(contentRange string) (int64, error) {
+	sizeStr, ok := strings.CutPrefix(contentRange, "bytes */")
+	if !ok {
+		return -1, errInvalidContentRange
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size < 0 {
+		return -1, errInvalidContentRange
+	}
+	return size, nil
+}
+
+// checkUnsatisfiable asserts a 416 response tells the client the content's actual size in a
+// `Content-Range: bytes */size` header, see RFC 9110 section 15.5.17
+func checkUnsatisfiable(knownSize int64, res *http.Response) {
+	if res.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		return
+	}
+
+	contentRange := res.Header.Get("Content-Range")
+	if contentRange == "" {
+		fmt.Println("416 response is missing content-range")
+		return
+	}
+
+	size, err := parseUnsatisfiedContentRange(contentRange)
+	switch {
+	case err != nil:
+		fmt.Printf("416 response has an invalid content-range: '%s'\n", contentRange)
+	case size != knownSize:
+		fmt.Printf("416 content-range size did not match content size: content-range: '%s' expected: %d\n", contentRange, knownSize)
+	default:
+		fmt.Println("416 content-range reports content size:", size)
+	}
+}
+
+// checkRangeStatus reports responses whose status surprises a client assuming full requests are answered
+// with 200 and range requests with 206: a 206 to a request without a range, or a 200 to a range request
+func checkRangeStatus(sources []rangeSource, res *http.Response) {
+	switch {
+	case len(sources) == 0 && res.StatusCode == http.StatusPartialContent:
+		fmt.Printf("unexpected 206 for a request without a range: content-range: '%s'\n", res.Header.Get("Content-Range"))
+	case len(sources) > 0 && res.StatusCode == http.StatusOK:
+		fmt.Printf("unexpected 200 for a range request, the range was ignored: content-length: %d\n", res.ContentLength)
+	}
+}
+
+// checkAcceptRanges flags 200 and 206 responses missing an Accept-Ranges header with the expected value,
+// since clients only attempt range requests against servers advertising support for them
+func checkAcceptRanges(expected string, res *http.Response) {
+	if expected == "" || (res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent) {
+		return
+	}
+
+	actual := res.Header.Values("Accept-Ranges")
+	switch {
+	case len(actual) == 0:
+		fmt.Printf("response is missing accept-ranges: expected: %s\n", expected)
+	case len(actual) > 1 || !strings.EqualFold(strings.TrimSpace(actual[0]), expected):
+		fmt.Printf("unexpected accept-ranges: expected: %s actual: %s\n", expected, strings.Join(actual, ", "))
+	}
+}
+
+// checkBodyLength flags responses whose body length disagrees with their Content-Length, and partial
+// responses that served more or fewer bytes than the requested range selects.
+func checkBodyLength(sources []rangeSource, res *http.Response, b []byte) {
+	// decoded bodies no longer match the Content-Length of the encoded representation
+	decoded := res.Header.Get("Content-Encoding") != "" && res.StatusCode == http.StatusOK
+	if res.ContentLength >= 0 && !decoded && res.ContentLength != int64(len(b)) {
+		fmt.Printf("content-length did not match bytes read: content-length: %d read: %d\n", res.ContentLength, len(b))
+	}
+
+	if res.StatusCode != http.StatusPartialContent || len(sources) == 0 {
+		return
+	}
+
+	contentRange := res.Header.Get("Content-Range")
+	first, last, size, err := parseContentRange(contentRange)
+	if err != nil {
+		fmt.Printf("could not determine served range from content-range: '%s'\n", contentRange)
+		size = contentMax
+	}
+
+	served := err == nil
+
+	var requested [][2]int64
+	for _, src := range sources {
+		start, end, err := rangeBounds(src.value, size)
+		if err != nil {
+			continue
+		}
+		if end >= size {
+			end = size - 1
+		}
+		// with several ranges sent, only the one the server served is checked
+		if len(sources) > 1 && (start != first || end != last) {
+			continue
+		}
+		requested = append(requested, [2]int64{start, end})
+	}
+
+	if len(requested) == 0 {
+		fmt.Printf("served range matched none of the requested ranges: content-range: '%s'\n", contentRange)
+		return
+	}
+
+	start, end := requested[0][0], requested[0][1]
+	expected := end - start + 1
+	switch {
+	case int64(len(b)) > expected && served && first <= start && last >= end:
+		// servers may widen ranges, ie to storage block boundaries, the requested bytes are still within
+		fmt.Printf("served range covers requested range: requested: %d-%d served: %d-%d extra bytes: %d\n", start, end, first, last, int64(len(b))-expected)
+	case int64(len(b)) > expected:
+		fmt.Printf("served more bytes than requested: requested: %d served: %d\n", expected, len(b))
+	case int64(len(b)) < expected:
+		fmt.Printf("served fewer bytes than requested: requested: %d served: %d\n", expected, len(b))
+	}
+}
+
+// sendTotalCheck compares the total size the server claims in Content-Range with the content it actually
+// serves, by fetching all content and the last byte within the claimed total.
+func sendTotalCheck(client *http.Client, url string, vbs bool) error {
+	total, ok, err := claimedTotal(client, url, "bytes=0-0", vbs)
+	if err != nil || !ok {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	res, b, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return err
+	}
+
+	lastByte := fmt.Sprintf("bytes=%d-%d", total-1, total-1)
+	lastTotal, lastOk, err := claimedTotal(client, url, lastByte, vbs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("total check:")
+	fmt.Println("claimed total:", total)
+	if res.StatusCode != http.StatusOK {
+		fmt.Printf("did not receive expected status for all content: expected: %d actual: %d\n", http.StatusOK, res.StatusCode)
+	} else if int64(len(b)) != total {
+		fmt.Printf("claimed total did not match full content length: claimed: %d served: %d\n", total, len(b))
+	} else {
+		fmt.Println("claimed total matches full content length")
+	}
+
+	if !lastOk {
+		fmt.Printf("last byte within claimed total could not be fetched: range: %s\n", lastByte)
+	} else if lastTotal != total {
+		fmt.Printf("claimed total changed between requests: first: %d last byte: %d\n", total, lastTotal)
+	} else {
+		fmt.Println("last byte within claimed total was fetched")
+	}
+	fmt.Println()
+
+	return nil
+}
+
+// claimedTotal requests a range and returns the total size claimed by the response's Content-Range,
+// reporting false if the range was not served as a 206 with a valid Content-Range
+func claimedTotal(client *http.Client, url, rng string, vbs bool) (int64, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Range", rng)
+
+	res, _, err := roundTrip(client, req, vbs)
+	if err != nil {
+		return 0, false, err
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		fmt.Printf("did not receive expected status: range: %s expected: %d actual: %d\n", rng, http.StatusPartialContent, res.StatusCode)
+		return 0, false, nil
+	}
+
+	_, _, total, err := parseContentRange(res.Header.Get("Content-Range"))
+	if err != nil {
+		fmt.Printf("could not parse content-range: '%s'\n", res.Header.Get("Content-Range"))
+		return 0, false, nil
+	}
+	return total, true, nil
+}
+
+// verifyPatternBody checks a response body byte for byte against the content a server run with --pattern-size
+// generates from seed, locating ranges by their Content-Range
+func verifyPatternBody(seed int64, res *http.Response, b []byte) {
+	var offset int64
+	switch {
+	case res.StatusCode == http.StatusPartialContent:
+		// encoded ranges are fragments of the encoded representation, and multipart bodies aren't content
+		if res.Header.Get("Content-Encoding") != "" || res.Header.Get("Content-Range") == "" {
+			fmt.Println("pattern not verified: response is not a single unencoded range")
+			return
+		}
+		first, _, _, err := parseContentRange(res.Header.Get("Content-Range"))
+		if err != nil {
+			fmt.Println("pattern not verified:", err.Error())
+			return
+		}
+		offset = first
+	case res.StatusCode != http.StatusOK:
+		return
+	}
+
+	if mismatch := pattern.Verify(seed, b, offset); mismatch >= 0 {
+		fmt.Printf("pattern mismatch: first differing byte at offset %d of range starting at %d\n", mismatch, offset)
+		return
+	}
+	fmt.Printf("pattern verified: %d bytes from offset %d\n", len(b), offset)
+}
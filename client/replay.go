@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// replayRequest is a single request read from a --replay file
+type replayRequest struct {
+	line    int
+	method  string
+	path    string
+	headers [][2]string
+}
+
+// parseReplayLine parses a request line of the form `METHOD /path | Name: value | Name: value`
+func parseReplayLine(text string) (replayRequest, error) {
+	fields := strings.Split(text, "|")
+
+	requestLine := strings.Fields(fields[0])
+	if len(requestLine) != 2 {
+		return replayRequest{}, fmt.Errorf("expected 'METHOD /path', found '%s'", strings.TrimSpace(fields[0]))
+	}
+	if !strings.HasPrefix(requestLine[1], "/") {
+		return replayRequest{}, fmt.Errorf("path must start with '/', found '%s'", requestLine[1])
+	}
+
+	rr := replayRequest{method: strings.ToUpper(requestLine[0]), path: requestLine[1]}
+	for _, field := range fields[1:] {
+		name, value, ok := strings.Cut(field, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return replayRequest{}, fmt.Errorf("failed to parse header '%s'", strings.TrimSpace(field))
+		}
+		rr.headers = append(rr.headers, [2]string{name, strings.TrimSpace(value)})
+	}
+	return rr, nil
+}
+
+// readReplayFile reads the requests of a --replay file. Blank lines and lines starting with `#` are
+// ignored, malformed lines are skipped with a warning.
+func readReplayFile(path string) ([]replayRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var requests []replayRequest
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		rr, err := parseReplayLine(text)
+		if err != nil {
+			fmt.Printf("skipping malformed replay line %d: %s\n", line, err.Error())
+			continue
+		}
+		rr.line = line
+		requests = append(requests, rr)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// sendReplay issues the requests of a --replay file, in order when concurrency is 1, and reports the
+// status and length of each response followed by a count of responses by status.
+func sendReplay(client *http.Client, url, path string, concurrency int, vbs bool) error {
+	requests, err := readReplayFile(path)
+	if err != nil {
+		return err
+	}
+
+	type replayResult struct {
+		status int
+		length int
+		err    error
+	}
+	results := make([]replayResult, len(requests))
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			rr := requests[i]
+			req, err := http.NewRequest(rr.method, url+rr.path, http.NoBody)
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			for _, hdr := range rr.headers {
+				req.Header.Add(hdr[0], hdr[1])
+			}
+			results[i].status, results[i].length, results[i].err = send(client, req, vbs)
+		}(i)
+	}
+	wg.Wait()
+
+	fmt.Println("replay results:")
+	statuses := make(map[int]int)
+	failed := 0
+	for i, res := range results {
+		rr := requests[i]
+		if res.err != nil {
+			failed++
+			fmt.Printf("line %d: %s %s error: %s\n", rr.line, rr.method, rr.path, res.err.Error())
+			continue
+		}
+		statuses[res.status]++
+		fmt.Printf("line %d: %s %s status: %d length: %d\n", rr.line, rr.method, rr.path, res.status, res.length)
+	}
+
+	var codes []int
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Printf("status %d: %d\n", code, statuses[code])
+	}
+	if failed > 0 {
+		fmt.Printf("failed: %d\n", failed)
+	}
+	fmt.Println()
+
+	return nil
+}
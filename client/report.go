@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var reportColumns = []string{"timestamp", "method", "range", "status", "bytes", "latency_ms"}
+
+// csvReport streams a row per request to a csv file as responses are received, so long runs aren't
+// held in memory
+type csvReport struct {
+	mu *sync.Mutex
+	f  *os.File
+	w  *csv.Writer
+}
+
+// report is nil unless --report is set
+var report *csvReport
+
+func openReport(path string) (*csvReport, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &csvReport{mu: &sync.Mutex{}, f: f, w: csv.NewWriter(f)}
+	if err = r.w.Write(reportColumns); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// record writes a row for a request and its fully read response body
+func (r *csvReport) record(req *http.Request, res *http.Response, b []byte, t *requestTimings) {
+	if r == nil {
+		return
+	}
+
+	var ranges []string
+	for _, src := range requestRangeSources(req) {
+		ranges = append(ranges, src.value)
+	}
+
+	row := []string{
+		t.start.UTC().Format(time.RFC3339Nano),
+		req.Method,
+		strings.Join(ranges, ";"),
+		strconv.Itoa(res.StatusCode),
+		strconv.Itoa(len(b)),
+		strconv.FormatFloat(float64(t.end.Sub(t.start).Microseconds())/1000, 'f', 3, 64),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.w.Write(row); err != nil {
+		fmt.Println("failed to write report row:", err.Error())
+		return
+	}
+	r.w.Flush()
+}
+
+func (r *csvReport) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.w.Flush()
+	if err := r.w.Error(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// closeReport flushes and closes the --report file once the run is complete
+func closeReport() {
+	if err := report.close(); err != nil {
+		fmt.Println("failed to write report:", err.Error())
+		return
+	}
+	fmt.Println("wrote report:", *reportOut)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// resolveOverrides maps the host:port of --resolve entries to the ip:port dialed instead
+var resolveOverrides map[string]string
+
+// parseResolve parses `host:port:ip` entries, like curl's --resolve. IPv6 addresses may be bracketed.
+func parseResolve(specs []string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("failed to parse --resolve '%s', expected host:port:ip", spec)
+		}
+
+		if _, err := strconv.ParseUint(parts[1], 10, 16); err != nil {
+			return nil, fmt.Errorf("invalid port in --resolve '%s'", spec)
+		}
+
+		ip := net.ParseIP(strings.Trim(parts[2], "[]"))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip in --resolve '%s'", spec)
+		}
+
+		overrides[net.JoinHostPort(parts[0], parts[1])] = net.JoinHostPort(ip.String(), parts[1])
+	}
+	return overrides, nil
+}
+
+// dialContext dials addr, or the ip --resolve overrides it with
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if override, ok := resolveOverrides[addr]; ok {
+		fmt.Println("resolving", addr, "to", override)
+		addr = override
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+// dialTLSContext dials addr with dialContext and performs the tls handshake, so the server name sent and
+// verified is the requested host even when its address is overridden
+func dialTLSContext(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+	conn, err := dialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg == nil {
+		cfg = &tls.Config{}
+	} else {
+		cfg = cfg.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// sendThroughput downloads the full content n times, streaming each body rather than buffering it, and
+// reports the throughput of each attempt and overall
+func sendThroughput(client *http.Client, url string, n int, vbs bool) error {
+	var totalBytes int64
+	var totalTime time.Duration
+	for i := 1; i <= n; i++ {
+		req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		written, err := io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		elapsed := time.Since(start)
+
+		if res.StatusCode != http.StatusOK {
+			fmt.Printf("did not receive expected status: url: %s expected: %d actual: %d\n", url, http.StatusOK, res.StatusCode)
+		}
+		if vbs {
+			fmt.Printf("attempt %d status: %s\n", i, res.Status)
+		}
+		fmt.Printf("attempt %d: %d bytes in %s: %.2f MB/s\n", i, written, elapsed, megabytesPerSecond(written, elapsed))
+
+		totalBytes += written
+		totalTime += elapsed
+	}
+
+	fmt.Println("throughput:")
+	fmt.Printf("downloaded %d bytes in %s over %d attempts: %.2f MB/s\n", totalBytes, totalTime, n, megabytesPerSecond(totalBytes, totalTime))
+	fmt.Println()
+
+	return nil
+}
+
+func megabytesPerSecond(bytes int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(bytes) / (1 << 20) / d.Seconds()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// requestLatencies collects the total time of each request when --timing is set
+var requestLatencies = &latencyRecorder{mu: &sync.Mutex{}}
+
+type latencyRecorder struct {
+	mu        *sync.Mutex
+	latencies []time.Duration
+}
+
+func (l *latencyRecorder) record(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.latencies = append(l.latencies, d)
+}
+
+// printPercentiles prints the min, median, p90, p99 and max of the recorded latencies
+func (l *latencyRecorder) printPercentiles() {
+	l.mu.Lock()
+	sorted := append([]time.Duration(nil), l.latencies...)
+	l.mu.Unlock()
+
+	if len(sorted) == 0 {
+		fmt.Println("timing: no requests completed")
+		return
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	fmt.Printf("timing over %d requests: min: %s median: %s p90: %s p99: %s max: %s\n", len(sorted),
+		sorted[0], percentile(sorted, 0.5), percentile(sorted, 0.9), percentile(sorted, 0.99), sorted[len(sorted)-1])
+}
+
+// percentile returns the nearest-rank p percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
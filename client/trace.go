@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// connReuse counts the connections obtained for requests, and how many of them were reused
+var connReuse = &reuseCounter{}
+
+type reuseCounter struct {
+	conns  int64
+	reused int64
+}
+
+func (c *reuseCounter) record(reused bool) {
+	atomic.AddInt64(&c.conns, 1)
+	if reused {
+		atomic.AddInt64(&c.reused, 1)
+	}
+}
+
+func (c *reuseCounter) counts() (int64, int64) {
+	return atomic.LoadInt64(&c.reused), atomic.LoadInt64(&c.conns)
+}
+
+// meetsRatio reports whether at least min of the connections obtained were reused, printing the outcome
+func (c *reuseCounter) meetsRatio(min float64) bool {
+	reused, conns := c.counts()
+	if conns == 0 {
+		fmt.Println("connection reuse check failed: no connections were obtained")
+		return false
+	}
+
+	ratio := float64(reused) / float64(conns)
+	if ratio < min {
+		fmt.Printf("connection reuse check failed: reused %d of %d, ratio %.2f below minimum %.2f\n", reused, conns, ratio, min)
+		return false
+	}
+	fmt.Printf("connection reuse check passed: reused %d of %d, ratio %.2f\n", reused, conns, ratio)
+	return true
+}
+
+// requestTimings holds the timestamps captured by the httptrace hooks installed on each request
+type requestTimings struct {
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConnAt    time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	end          time.Time
+	gotConn      bool
+	reused       bool
+}
+
+func (t *requestTimings) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.dnsDone = time.Now()
+		},
+		ConnectStart: func(network, addr string) {
+			// dialers may race several addresses, keep the earliest start
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				t.connectDone = time.Now()
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.tlsDone = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.gotConn = true
+			t.gotConnAt = time.Now()
+			t.reused = info.Reused
+			connReuse.record(info.Reused)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.firstByte = time.Now()
+		},
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			fmt.Println("received interim response:", code)
+			for name, values := range header {
+				for _, value := range values {
+					fmt.Printf("with interim header: '%s: %s'\n", name, value)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func (t *requestTimings) printLatency() {
+	// time to first byte is dominated by server processing, transfer time by the body read
+	if !t.firstByte.IsZero() {
+		fmt.Println("time to first byte:", t.firstByte.Sub(t.start))
+		fmt.Println("transfer time:", t.end.Sub(t.firstByte))
+	}
+	fmt.Println("total time:", t.end.Sub(t.start))
+}
+
+func (t *requestTimings) printReuse() {
+	if t.gotConn {
+		fmt.Println("connection reused:", t.reused)
+	}
+}
+
+func (t *requestTimings) printConnection() {
+	fmt.Println("connection timings:")
+	printPhase("dns lookup", t.dnsStart, t.dnsDone)
+	printPhase("tcp connect", t.connectStart, t.connectDone)
+	printPhase("tls handshake", t.tlsStart, t.tlsDone)
+}
+
+func printPhase(name string, start, done time.Time) {
+	if start.IsZero() || done.IsZero() {
+		fmt.Printf("%s: none\n", name)
+		return
+	}
+	fmt.Printf("%s: %s\n", name, done.Sub(start))
+}
+
+// printServerTiming prints the metrics of a response's Server-Timing headers, ie `range;dur=1.2, total;dur=3.4`
+func printServerTiming(h http.Header) {
+	for _, value := range h.Values("Server-Timing") {
+		for _, metric := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(metric), ";")
+			if name == "" {
+				continue
+			}
+
+			dur := "none"
+			for _, param := range strings.Split(params, ";") {
+				key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(key, "dur") {
+					dur = val + "ms"
+				}
+			}
+			fmt.Printf("server timing %s: %s\n", name, dur)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// contentDigestTrailer is the trailer the server sends with the sha256 of the response body
+const contentDigestTrailer = "X-Content-Sha256"
+
+// checkTrailers prints the trailers of a response, asserting they were received only when the request
+// sent `TE: trailers`, and that the digest trailer matches the body as received.
+func checkTrailers(requested bool, res *http.Response, b []byte) {
+	for name, values := range res.Trailer {
+		for _, value := range values {
+			fmt.Printf("with trailer: '%s: %s'\n", name, value)
+		}
+	}
+
+	if !requested {
+		if len(res.Trailer) > 0 {
+			fmt.Println("received trailers although TE: trailers was not sent")
+		}
+		return
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		return
+	}
+
+	digest := res.Trailer.Get(contentDigestTrailer)
+	if digest == "" {
+		fmt.Println("did not receive trailers although TE: trailers was sent")
+		return
+	}
+
+	sum := sha256.Sum256(b)
+	if actual := hex.EncodeToString(sum[:]); actual != digest {
+		fmt.Printf("body did not match digest trailer: trailer: %s actual: %s\n", digest, actual)
+	}
+}
+
+// trailerRange is the range sent in a request trailer by --range-trailer
+const trailerRange = "bytes=0-9"
+
+// sendRangeTrailer sends a GET with its Range in a request trailer rather than a header, as some malformed
+// clients do, and checks the server ignored it and served all content. Trailers only exist on chunked
+// bodies, so the request has a small body of unknown length.
+func sendRangeTrailer(client *http.Client, url string, vbs bool) error {
+	newBody := func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("range in trailer")), nil
+	}
+	body, _ := newBody()
+	req, err := http.NewRequest(http.MethodGet, url, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = -1
+	req.GetBody = newBody
+	req.Trailer = http.Header{"Range": []string{trailerRange}}
+
+	fmt.Println("sending range in request trailer:", trailerRange)
+	res, b, err := roundTrip(client, req, vbs)
+	// http2 forbids Range in trailers, so servers reset the stream rather than serving the request
+	if err != nil && strings.Contains(err.Error(), "PROTOCOL_ERROR") {
+		fmt.Println("range trailer:")
+		fmt.Println("request with range in trailer was rejected:", err.Error())
+		fmt.Println()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("range trailer:")
+	if res.StatusCode == http.StatusOK && res.Header.Get("Content-Range") == "" {
+		fmt.Println("range in trailer was ignored, served all content:", len(b))
+	} else {
+		fmt.Printf("range in trailer was not ignored: expected: %d actual: %d content-range: '%s'\n",
+			http.StatusOK, res.StatusCode, res.Header.Get("Content-Range"))
+	}
+	fmt.Println()
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// expectContinueTimeout is how long the client waits for `100 Continue` before sending a body anyway
+const expectContinueTimeout = 5 * time.Second
+
+// uploadTimings records when the interim response arrived and when the body was first read for sending
+type uploadTimings struct {
+	mu          *sync.Mutex
+	gotContinue time.Time
+	bodySent    time.Time
+}
+
+// firstReadReader calls onRead before the first read of the body it wraps
+type firstReadReader struct {
+	r      io.Reader
+	once   sync.Once
+	onRead func()
+}
+
+func (f *firstReadReader) Read(p []byte) (int, error) {
+	f.once.Do(f.onRead)
+	return f.r.Read(p)
+}
+
+// sendUpload PUTs size bytes to /upload with `Expect: 100-continue`, reporting whether the server's
+// `100 Continue` arrived before the body was sent
+func sendUpload(client *http.Client, url string, size int, vbs bool) error {
+	// a transport without an expect continue timeout sends the body without waiting
+	if t, ok := client.Transport.(*http.Transport); ok && t.ExpectContinueTimeout == 0 {
+		t = t.Clone()
+		t.ExpectContinueTimeout = expectContinueTimeout
+		client = &http.Client{Transport: t}
+	}
+
+	timings := &uploadTimings{mu: &sync.Mutex{}}
+	body := &firstReadReader{
+		r: bytes.NewReader(bytes.Repeat([]byte("u"), size)),
+		onRead: func() {
+			timings.mu.Lock()
+			defer timings.mu.Unlock()
+			timings.bodySent = time.Now()
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodPut, url+"/upload", body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(size)
+	req.Header.Set("Expect", "100-continue")
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		Got100Continue: func() {
+			timings.mu.Lock()
+			defer timings.mu.Unlock()
+			timings.gotContinue = time.Now()
+		},
+	}))
+
+	res, b, err := roundTripOnce(client, req, vbs)
+	if err != nil {
+		return err
+	}
+
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+
+	fmt.Println("upload:")
+	fmt.Println("status:", res.Status)
+	fmt.Println("server response:", string(b))
+	if timings.gotContinue.IsZero() {
+		fmt.Println("did not receive 100 continue")
+	} else {
+		fmt.Println("received 100 continue")
+	}
+
+	switch {
+	case timings.bodySent.IsZero():
+		fmt.Println("body was not sent")
+	case !timings.gotContinue.IsZero() && !timings.bodySent.Before(timings.gotContinue):
+		fmt.Println("body sent after 100 continue:", timings.bodySent.Sub(timings.gotContinue))
+	default:
+		fmt.Println("body sent before 100 continue was received")
+	}
+	fmt.Println()
+
+	return nil
+}
@@ -1,7 +1,11 @@
 module github.com/dolthub/headers_tester
 
-go 1.19
+go 1.20
 
-require golang.org/x/net v0.10.0
+require (
+	github.com/andybalholm/brotli v1.0.5
+	golang.org/x/crypto v0.9.0
+	golang.org/x/net v0.10.0
+)
 
 require golang.org/x/text v0.9.0 // indirect
@@ -0,0 +1,44 @@
+// Package pattern generates deterministic content that the headers tester server serves and the client
+// verifies. Every byte is a function of a seed and its offset, so any range can be checked without
+// downloading the rest of the content.
+package pattern
+
+// blockSize is the number of bytes generated from each mixed value
+const blockSize = 8
+
+// ByteAt returns the byte at offset of content of size bytes generated from seed. Offsets outside the
+// content return 0.
+func ByteAt(seed, size, offset int64) byte {
+	if offset < 0 || offset >= size {
+		return 0
+	}
+	return byte(block(seed, offset/blockSize) >> (8 * uint(offset%blockSize)))
+}
+
+// Fill fills buf with the content generated from seed, starting at fromOffset.
+func Fill(seed int64, buf []byte, fromOffset int64) {
+	for i := range buf {
+		offset := fromOffset + int64(i)
+		buf[i] = byte(block(seed, offset/blockSize) >> (8 * uint(offset%blockSize)))
+	}
+}
+
+// Verify returns the offset of the first byte of b, read from fromOffset, that differs from the content
+// generated from seed, or -1 if every byte matches.
+func Verify(seed int64, b []byte, fromOffset int64) int64 {
+	for i, actual := range b {
+		offset := fromOffset + int64(i)
+		if actual != byte(block(seed, offset/blockSize)>>(8*uint(offset%blockSize))) {
+			return offset
+		}
+	}
+	return -1
+}
+
+// block mixes the seed and block index with splitmix64, so neighboring blocks and seeds share no structure
+func block(seed, index int64) uint64 {
+	z := uint64(seed) + uint64(index+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
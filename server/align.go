@@ -0,0 +1,17 @@
+package main
+
+// alignRange widens a range outward to multiples of alignment, modeling block aligned storage that can
+// only read whole blocks. The aligned end is clamped to the content size, ranges already ending beyond the
+// content are left for the caller to reject.
+func alignRange(offset, length, alignment, size int64) (int64, int64) {
+	end := offset + length
+	alignedStart := offset - offset%alignment
+	alignedEnd := (end + alignment - 1) / alignment * alignment
+	if alignedEnd > size {
+		alignedEnd = size
+		if end > size {
+			alignedEnd = end
+		}
+	}
+	return alignedStart, alignedEnd - alignedStart
+}
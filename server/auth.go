@@ -0,0 +1,31 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+)
+
+// checkDoltAuth responds 403 Forbidden unless the request's X-Dolt-Auth header matches --require-dolt-auth,
+// returning false when the request should not be served. The comparison is constant time so the token
+// can't be discovered by timing responses.
+func checkDoltAuth(w http.ResponseWriter, req *http.Request) bool {
+	if *requireDoltAuth == "" {
+		return true
+	}
+
+	token := req.Header.Get("X-Dolt-Auth")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(*requireDoltAuth)) == 1 {
+		return true
+	}
+
+	if token == "" {
+		fmt.Fprintln(logOut, "missing x-dolt-auth header")
+	} else {
+		fmt.Fprintln(logOut, "x-dolt-auth header did not match")
+	}
+	fmt.Fprintln(logOut, "status-code:", http.StatusForbidden)
+	fmt.Fprintln(logOut)
+	w.WriteHeader(http.StatusForbidden)
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// byteSpan is the half open interval of content offsets [start, end)
+type byteSpan struct {
+	start int64
+	end   int64
+}
+
+// availableRanges are the spans of content the server has, nil if all content is available
+var availableRanges []byteSpan
+
+// parseAvailableRanges parses a comma separated list of inclusive byte ranges, ie `0-999,2000-2999`
+func parseAvailableRanges(spec string) ([]byteSpan, error) {
+	var spans []byteSpan
+	for _, rng := range strings.Split(spec, ",") {
+		first, last, ok := strings.Cut(strings.TrimSpace(rng), "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid available range '%s'", rng)
+		}
+
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid available range '%s'", rng)
+		}
+
+		end, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start || start < 0 {
+			return nil, fmt.Errorf("invalid available range '%s'", rng)
+		}
+
+		spans = append(spans, byteSpan{start: start, end: end + 1})
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	return spans, nil
+}
+
+// availableOverlap returns the offset and length of the first available span of content within the
+// requested range. A range that spans a gap is truncated at the end of the first available span it
+// overlaps. Returns false if none of the requested range is available.
+func availableOverlap(spans []byteSpan, offset, length int64) (int64, int64, bool) {
+	end := offset + length
+	for _, span := range spans {
+		if span.end <= offset || span.start >= end {
+			continue
+		}
+
+		start := offset
+		if span.start > start {
+			start = span.start
+		}
+		stop := end
+		if span.end < stop {
+			stop = span.end
+		}
+		return start, stop - start, true
+	}
+	return -1, -1, false
+}
+
+// writeRangeNotSatisfiable responds 416 with the Content-Range informing the client of the content size
+func writeRangeNotSatisfiable(w http.ResponseWriter, size int64) {
+	contentRange := fmt.Sprintf("bytes */%d", size)
+	statusCode := http.StatusRequestedRangeNotSatisfiable
+
+	fmt.Fprintln(logOut, "responding:")
+	fmt.Fprintln(logOut, "content-range:", contentRange)
+	fmt.Fprintln(logOut, "status-code:", statusCode)
+	fmt.Fprintln(logOut)
+
+	w.Header().Add("Content-Range", contentRange)
+	w.WriteHeader(statusCode)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+)
+
+const (
+	bannerText = "text"
+	bannerJSON = "json"
+)
+
+// startupBanner describes the listening server for scripts waiting on it to start
+type startupBanner struct {
+	Event       string `json:"event"`
+	PID         int    `json:"pid"`
+	HTTPAddr    string `json:"http_addr"`
+	HTTPPort    int    `json:"http_port"`
+	HTTPSAddr   string `json:"https_addr"`
+	HTTPSPort   int    `json:"https_port"`
+	TLS         bool   `json:"tls"`
+	ContentSize int64  `json:"content_size"`
+	Objects     int    `json:"objects,omitempty"`
+	NoRangeAddr string `json:"no_range_addr,omitempty"`
+	NoRangePort int    `json:"no_range_port,omitempty"`
+}
+
+// printBanner reports the addresses the servers are listening on, as human readable lines or, with
+// --banner json, a single json object
+func printBanner(httpAddr, httpsAddr, noRangeAddr net.Addr) {
+	if *banner != bannerJSON {
+		fmt.Fprintln(logOut, "Serving http on :", *port)
+		fmt.Fprintln(logOut, "Serving https on :", *securePort)
+		if noRangeAddr != nil {
+			fmt.Fprintln(logOut, "Serving http without ranges on :", *noRangePort)
+		}
+		return
+	}
+
+	b := startupBanner{
+		Event:     "ready",
+		PID:       os.Getpid(),
+		HTTPAddr:  httpAddr.String(),
+		HTTPSAddr: httpsAddr.String(),
+		TLS:       true,
+	}
+	if tcpAddr, ok := httpAddr.(*net.TCPAddr); ok {
+		b.HTTPPort = tcpAddr.Port
+	}
+	if tcpAddr, ok := httpsAddr.(*net.TCPAddr); ok {
+		b.HTTPSPort = tcpAddr.Port
+	}
+	if noRangeAddr != nil {
+		b.NoRangeAddr = noRangeAddr.String()
+		if tcpAddr, ok := noRangeAddr.(*net.TCPAddr); ok {
+			b.NoRangePort = tcpAddr.Port
+		}
+	}
+
+	if objects := loadedObjects(); objects == nil {
+		b.ContentSize = newContents().Len()
+	} else {
+		for _, obj := range objects {
+			b.ContentSize += obj.Len()
+		}
+		b.Objects = len(objects)
+	}
+
+	out, err := json.Marshal(b)
+	if err != nil {
+		fmt.Fprintln(logOut, "failed to encode banner:", err.Error())
+		return
+	}
+	fmt.Fprintln(logOut, string(out))
+}
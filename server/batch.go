@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+)
+
+var errEmptyBatch = errors.New("batch contains no ranges")
+
+// batchRange is a single range of a /batch request body
+type batchRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// serveBatch responds to a POST of a json array of ranges with a multipart/byteranges body
+// containing one part per range, in the order requested.
+func serveBatch(w http.ResponseWriter, req *http.Request, contents *inMemContents, vbs bool) {
+	fmt.Fprintln(logOut, "received batch request")
+
+	if req.ContentLength > maxBodySize {
+		writeBodyTooLarge(w, req.ContentLength)
+		return
+	}
+
+	limitBody(w, req)
+	var ranges []batchRange
+	err := json.NewDecoder(req.Body).Decode(&ranges)
+	if isBodyTooLarge(err) {
+		writeBodyTooLarge(w, req.ContentLength)
+		return
+	}
+	if err == nil && len(ranges) == 0 {
+		err = errEmptyBatch
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(logOut, "bad request:", err.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	fmt.Fprintln(logOut, "responding:")
+	for _, rng := range ranges {
+		if rng.Length <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(logOut, "bad request:", errInvalidRange.Error())
+			fmt.Fprintln(logOut)
+			return
+		}
+
+		b, err := contents.ReadRange(rng.Offset, rng.Offset+rng.Length)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(logOut, "bad request:", err.Error())
+			fmt.Fprintln(logOut)
+			return
+		}
+
+		contentRange := formatContentRange(rng.Offset, rng.Length, contents.Len())
+		fmt.Fprintln(logOut, "part content-range:", contentRange)
+
+		if err = writePart(mw, contentRange, b); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintln(logOut, "failed to write batch part:", err.Error())
+			fmt.Fprintln(logOut)
+			return
+		}
+
+		if vbs {
+			fmt.Fprintln(logOut, "encoded part:", base64.StdEncoding.EncodeToString(b))
+		}
+	}
+
+	if err = mw.Close(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(logOut, "failed to write batch:", err.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	contentLength := strconv.Itoa(buf.Len())
+	statusCode := http.StatusOK
+
+	fmt.Fprintln(logOut, "content-length:", contentLength)
+	fmt.Fprintln(logOut, "status-code:", statusCode)
+	fmt.Fprintln(logOut)
+
+	w.Header().Add("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.Header().Add("Content-Length", contentLength)
+	w.WriteHeader(statusCode)
+
+	n, err := writeFull(w, buf.Bytes())
+	if err != nil {
+		fmt.Fprintf(logOut, "failed to write batch: wrote %d of %d: %s\n", n, buf.Len(), err.Error())
+		fmt.Fprintln(logOut)
+	}
+}
+
+// writePart adds a part holding b, described by contentRange, to a multipart/byteranges body
+func writePart(mw *multipart.Writer, contentRange string, b []byte) error {
+	part, err := mw.CreatePart(partHeader(contentRange))
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(b)
+	return err
+}
+
+// partHeader returns the header of a multipart/byteranges part holding the bytes of contentRange
+func partHeader(contentRange string) textproto.MIMEHeader {
+	hdr := textproto.MIMEHeader{}
+	hdr.Set("Content-Type", "application/octet-stream")
+	hdr.Set("Content-Range", contentRange)
+	return hdr
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag returns a strong entity tag derived from the contents. It is computed once, as hashing the larger
+// contents on every request would dominate their response times.
+func (c *inMemContents) ETag() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.etag == "" {
+		var sum [sha256.Size]byte
+		if c.generated {
+			// generated contents are determined by their seed and size, which are hashed instead of producing them
+			sum = sha256.Sum256([]byte(fmt.Sprintf("pattern:%d:%d", c.seed, c.size)))
+		} else {
+			sum = sha256.Sum256(c.contents)
+		}
+		c.etag = `"` + hex.EncodeToString(sum[:8]) + `"`
+	}
+	return c.etag
+}
+
+// etagListMatches reports whether a comma separated list of entity tags from a conditional header
+// matches etag. `*` matches any current representation. Strong comparison never matches weak tags,
+// see RFC 9110 section 8.8.3.2.
+func etagListMatches(list, etag string, strong bool) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strong {
+			if tag == etag && !strings.HasPrefix(tag, "W/") {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch responds 412 Precondition Failed if the request's If-Match header does not match etag,
+// returning false when the request should not be served.
+func checkIfMatch(w http.ResponseWriter, req *http.Request, etag string) bool {
+	ifMatch := req.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+
+	if etagListMatches(ifMatch, etag, true) {
+		fmt.Fprintln(logOut, "if-match matched:", ifMatch)
+		return true
+	}
+
+	fmt.Fprintln(logOut, "if-match did not match:", ifMatch)
+	fmt.Fprintln(logOut, "status-code:", http.StatusPreconditionFailed)
+	fmt.Fprintln(logOut)
+	w.WriteHeader(http.StatusPreconditionFailed)
+	return false
+}
+
+// checkIfNoneMatch responds 304 Not Modified if the request's If-None-Match header matches etag, returning
+// false when the request should not be served.
+func checkIfNoneMatch(w http.ResponseWriter, req *http.Request, etag string) bool {
+	ifNoneMatch := req.Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return true
+	}
+
+	if !etagListMatches(ifNoneMatch, etag, false) {
+		fmt.Fprintln(logOut, "if-none-match did not match:", ifNoneMatch)
+		return true
+	}
+
+	fmt.Fprintln(logOut, "if-none-match matched:", ifNoneMatch)
+	fmt.Fprintln(logOut, "status-code:", http.StatusNotModified)
+	fmt.Fprintln(logOut)
+	w.WriteHeader(http.StatusNotModified)
+	return false
+}
+
+// ifRangeMatches reports whether a range request should be served as a range. Requests without an
+// If-Range header always are, otherwise its etag must strongly match etag, or its date must not be older
+// than the last modified time. Accepting newer dates is deliberately more lenient than RFC 9110 section
+// 13.1.5 and net/http's ServeContent, which both require the date to match exactly, so clients can be
+// tested sending any date they've seen since the content last changed.
+func ifRangeMatches(req *http.Request, etag string, modTime time.Time) bool {
+	ifRange := req.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return ifRange == etag && !strings.HasPrefix(ifRange, "W/")
+	}
+
+	date, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	return !date.Before(modTime.Truncate(time.Second))
+}
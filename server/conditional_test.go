@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIfRangeMatrix(t *testing.T) {
+	srv := httptest.NewServer(getHttpServer(0, false, true).Handler)
+	defer srv.Close()
+
+	etag := builtInContents.ETag()
+	lastModified := builtInContents.modTime
+
+	tests := []struct {
+		name    string
+		weak    bool
+		ifRange string
+		status  int
+	}{
+		{name: "matching etag", ifRange: etag, status: http.StatusPartialContent},
+		{name: "mismatched etag", ifRange: `"0123456789abcdef"`, status: http.StatusOK},
+		{name: "weak validator of matching etag", ifRange: "W/" + etag, status: http.StatusOK},
+		{name: "weak etag served, weak validator sent", weak: true, ifRange: "W/" + etag, status: http.StatusOK},
+		{name: "weak etag served, strong validator sent", weak: true, ifRange: etag, status: http.StatusOK},
+		{name: "weak etag served, mismatched validator sent", weak: true, ifRange: `W/"0123456789abcdef"`, status: http.StatusOK},
+		{name: "date equal to last modified", ifRange: lastModified.Format(http.TimeFormat), status: http.StatusPartialContent},
+		{name: "date newer than last modified", ifRange: lastModified.Add(time.Hour).Format(http.TimeFormat), status: http.StatusPartialContent},
+		{name: "date older than last modified", ifRange: lastModified.Add(-time.Hour).Format(http.TimeFormat), status: http.StatusOK},
+		{name: "date with weak etag served", weak: true, ifRange: lastModified.Format(http.TimeFormat), status: http.StatusPartialContent},
+		{name: "invalid date", ifRange: "yesterday", status: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setFlag(t, weakETag, test.weak)
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL, http.NoBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Range", "bytes=0-99")
+			req.Header.Set("If-Range", test.ifRange)
+
+			res, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, res.StatusCode)
+			}
+
+			expectedContentRange := ""
+			if test.status == http.StatusPartialContent {
+				expectedContentRange = "bytes 0-99/4000"
+			}
+			if contentRange := res.Header.Get("Content-Range"); contentRange != expectedContentRange {
+				t.Errorf("expected content-range '%s', got: '%s'", expectedContentRange, contentRange)
+			}
+		})
+	}
+}
+
+func TestWeakETag(t *testing.T) {
+	setFlag(t, weakETag, true)
+
+	weak := serveRequest(t, nil).Header().Get("ETag")
+	if !strings.HasPrefix(weak, `W/"`) {
+		t.Fatalf("expected a weak etag, got: '%s'", weak)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{name: "range with weak if-range", header: http.Header{"Range": {"bytes=0-99"}, "If-Range": {weak}}, status: http.StatusOK},
+		{name: "range with strong if-range", header: http.Header{"Range": {"bytes=0-99"}, "If-Range": {strings.TrimPrefix(weak, "W/")}}, status: http.StatusOK},
+		{name: "range without if-range", header: http.Header{"Range": {"bytes=0-99"}}, status: http.StatusPartialContent},
+		{name: "if-none-match weak comparison", header: http.Header{"If-None-Match": {weak}}, status: http.StatusNotModified},
+		{name: "if-match strong comparison", header: http.Header{"If-Match": {weak}}, status: http.StatusPreconditionFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serveRequest(t, test.header)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, w.Code)
+			}
+			// a range refused by a weak validator is served as all of the content
+			if test.status == http.StatusOK && w.Body.Len() != builtInSize {
+				t.Errorf("expected all %d bytes of content, got: %d", builtInSize, w.Body.Len())
+			}
+		})
+	}
+}
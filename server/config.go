@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// applyConfig sets flags from a config file with one `name=value` per line. Blank lines and lines
+// starting with `#` are ignored, and a boolean flag may be given by name alone. Flags set on the
+// command line take precedence over the config file, and flags not set by either are reset to their
+// defaults, so removing a line from the file reverts that setting on reload.
+func applyConfig(path string) error {
+	settings, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+
+	cliFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		cliFlags[f.Name] = true
+	})
+
+	var setErr error
+	flag.VisitAll(func(f *flag.Flag) {
+		if setErr != nil || cliFlags[f.Name] || f.Name == "config" {
+			return
+		}
+
+		value, ok := settings[f.Name]
+		if !ok {
+			value = f.DefValue
+		}
+
+		if err := f.Value.Set(value); err != nil {
+			setErr = fmt.Errorf("invalid value '%s' for config setting '%s': %w", value, f.Name, err)
+		}
+	})
+
+	return setErr
+}
+
+func readConfig(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimLeft(strings.TrimSpace(name), "-")
+		value = strings.TrimSpace(value)
+
+		fl := flag.Lookup(name)
+		if fl == nil || name == "config" || name == "version" {
+			return nil, fmt.Errorf("%s:%d: unknown config setting '%s'", path, lineNum, name)
+		}
+
+		if !ok {
+			if bf, isBool := fl.Value.(interface{ IsBoolFlag() bool }); !isBool || !bf.IsBoolFlag() {
+				return nil, fmt.Errorf("%s:%d: config setting '%s' requires a value", path, lineNum, name)
+			}
+			value = "true"
+		}
+
+		settings[name] = value
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// reloadConfig reapplies the config file, if there is one, and reconfigures the server. If the new
+// settings are invalid the previous settings are restored.
+func reloadConfig() error {
+	if *configFile == "" {
+		return configure()
+	}
+
+	previous := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		previous[f.Name] = f.Value.String()
+	})
+
+	err := applyConfig(*configFile)
+	if err == nil {
+		err = configure()
+	}
+
+	if err != nil {
+		flag.VisitAll(func(f *flag.Flag) {
+			_ = f.Value.Set(previous[f.Name])
+		})
+		if cerr := configure(); cerr != nil {
+			return cerr
+		}
+	}
+
+	return err
+}
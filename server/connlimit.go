@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// connLimiter tracks active connections by remote ip and closes new connections from an ip that
+// already has the maximum number of active connections.
+type connLimiter struct {
+	max   int
+	mu    *sync.Mutex
+	conns map[string]int
+}
+
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{
+		max:   max,
+		mu:    &sync.Mutex{},
+		conns: make(map[string]int),
+	}
+}
+
+// connState is used as an http.Server ConnState hook. Rejected connections are still counted until
+// the server reports them closed, so every StateNew is matched by exactly one decrement.
+func (l *connLimiter) connState(conn net.Conn, state http.ConnState) {
+	ip := remoteIP(conn)
+
+	switch state {
+	case http.StateNew:
+		l.mu.Lock()
+		l.conns[ip]++
+		active := l.conns[ip]
+		l.mu.Unlock()
+
+		if active > l.max {
+			fmt.Fprintln(logOut, "rejecting connection from", ip, "active connections:", active-1)
+			fmt.Fprintln(logOut)
+			conn.Close()
+		}
+	case http.StateHijacked, http.StateClosed:
+		l.mu.Lock()
+		l.conns[ip]--
+		if l.conns[ip] <= 0 {
+			delete(l.conns, ip)
+		}
+		l.mu.Unlock()
+	}
+}
+
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return ip
+}
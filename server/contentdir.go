@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// contentObjects holds the files of --content-dir served by name. The map is replaced as a whole when the
+// directory is reloaded, so requests already being served keep the objects they started with.
+var contentObjects atomic.Pointer[map[string]*inMemContents]
+
+// loadedObjects returns the --content-dir objects currently served, nil when serving the built in content
+func loadedObjects() map[string]*inMemContents {
+	if objects := contentObjects.Load(); objects != nil {
+		return *objects
+	}
+	return nil
+}
+
+// reloadContentDir re-reads --content-dir and swaps in its objects for new requests. The previous objects
+// are kept if it fails to load.
+func reloadContentDir() {
+	if *contentDir == "" {
+		fmt.Fprintln(logOut, "no --content-dir to reload")
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	objects, err := loadContentDir(*contentDir, *contentDirRecursive)
+	if err != nil {
+		fmt.Fprintln(logOut, "failed to reload content dir, keeping previous objects:", err.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+	contentObjects.Store(&objects)
+
+	fmt.Fprintln(logOut, "reloaded objects from content dir:", len(objects))
+	fmt.Fprintln(logOut)
+}
+
+// watchContentReload reloads --content-dir each time a signal is received
+func watchContentReload(sig <-chan os.Signal) {
+	for range sig {
+		reloadContentDir()
+	}
+}
+
+// loadContentDir reads every regular file of dir into memory, keyed by its slash separated path relative
+// to dir. Subdirectories are only descended into when recursive. A file with a gzip compressed companion
+// named <name>.gz is served from the companion to clients accepting gzip.
+func loadContentDir(dir string, recursive bool) (map[string]*inMemContents, error) {
+	objects := make(map[string]*inMemContents)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		objects[filepath.ToSlash(name)] = &inMemContents{
+			mu:       &sync.Mutex{},
+			contents: b,
+			modTime:  info.ModTime().UTC().Truncate(time.Second),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load --content-dir %s: %w", dir, err)
+	}
+
+	// <name>.gz files are still served by their own name as well
+	for name, obj := range objects {
+		if original, ok := objects[strings.TrimSuffix(name, ".gz")]; ok && strings.HasSuffix(name, ".gz") {
+			original.precompressed = obj
+		}
+	}
+	return objects, nil
+}
+
+// objectListing is an entry of the --content-dir index
+type objectListing struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// serveObjects serves the --content-dir index at `/` and each object at `/<name>`, or the built in
+// content when no --content-dir is set
+func serveObjects(w http.ResponseWriter, req *http.Request, vbs bool) {
+	objects := loadedObjects()
+	if objects == nil {
+		serveContents(w, req, builtInContents, vbs)
+		return
+	}
+
+	if req.URL.Path == "/" {
+		serveListing(w, objects)
+		return
+	}
+
+	name := strings.TrimPrefix(req.URL.Path, "/")
+	obj, ok := objects[name]
+	if !ok {
+		fmt.Fprintln(logOut, "object not found:", name)
+		fmt.Fprintln(logOut, "status-code:", http.StatusNotFound)
+		fmt.Fprintln(logOut)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	fmt.Fprintln(logOut, "serving object:", name)
+	serveContents(w, req, obj, vbs)
+}
+
+// serveListing responds with a json array of the names and sizes of the --content-dir objects
+func serveListing(w http.ResponseWriter, objects map[string]*inMemContents) {
+	fmt.Fprintln(logOut, "received listing request")
+
+	listing := []objectListing{}
+	for name, obj := range objects {
+		listing = append(listing, objectListing{Name: name, Size: obj.Len()})
+	}
+	sort.Slice(listing, func(i, j int) bool {
+		return listing[i].Name < listing[j].Name
+	})
+
+	b, err := json.Marshal(listing)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(logOut, "failed to encode listing:", err.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	fmt.Fprintln(logOut, "content-length:", len(b))
+	fmt.Fprintln(logOut, "status-code:", http.StatusOK)
+	fmt.Fprintln(logOut)
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = w.Write(b); err != nil {
+		fmt.Fprintln(logOut, "failed to write listing:", err.Error())
+		fmt.Fprintln(logOut)
+	}
+}
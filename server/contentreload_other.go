@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyContentReload does nothing on platforms without SIGUSR1
+func notifyContentReload(c chan<- os.Signal) {}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyContentReload relays SIGUSR1 to c
+func notifyContentReload(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// fixedDateHeader is the parsed --fixed-date formatted as an http date, empty when unset
+var fixedDateHeader string
+
+// parseFixedDate parses an http date, ie `Mon, 02 Jan 2006 15:04:05 GMT`, or an RFC 3339 timestamp
+func parseFixedDate(spec string) (string, error) {
+	t, err := http.ParseTime(spec)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, spec)
+		if err != nil {
+			return "", err
+		}
+	}
+	return t.UTC().Format(http.TimeFormat), nil
+}
+
+// withDateHeader sets the Date header to --fixed-date, or suppresses it with --no-date, before calling
+// next. net/http only adds a Date header when the response doesn't already have one, and a nil value
+// keeps it from being sent at all.
+func withDateHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if *noDate {
+			w.Header()["Date"] = nil
+		} else if fixedDateHeader != "" {
+			w.Header().Set("Date", fixedDateHeader)
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// sendEarlyHints sends a `103 Early Hints` interim response with a Link preload of the requested path. It
+// is written to the connection's own writer, since the response wrappers treat their first status as final.
+// http/1.0 clients don't understand interim responses, so they never get one.
+func sendEarlyHints(w http.ResponseWriter, req *http.Request) {
+	if !req.ProtoAtLeast(1, 1) {
+		return
+	}
+
+	link := fmt.Sprintf("<%s>; rel=preload; as=fetch", req.URL.Path)
+	fmt.Fprintln(logOut, "sending early hints:", link)
+
+	w.Header().Add("Link", link)
+	w.WriteHeader(http.StatusEarlyHints)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// echoResponse describes the request as it was received by the server
+type echoResponse struct {
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Proto   string              `json:"proto"`
+	Host    string              `json:"host"`
+	Headers map[string][]string `json:"headers"`
+}
+
+// serveEcho responds with the method, url and headers of the request as json
+func serveEcho(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(logOut, "received echo request")
+
+	b, err := json.Marshal(echoResponse{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Proto:   req.Proto,
+		Host:    req.Host,
+		Headers: req.Header,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(logOut, "failed to encode echo response:", err.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	fmt.Fprintln(logOut, "content-length:", len(b))
+	fmt.Fprintln(logOut, "status-code:", http.StatusOK)
+	fmt.Fprintln(logOut)
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = w.Write(b); err != nil {
+		fmt.Fprintln(logOut, "failed to write echo response:", err.Error())
+		fmt.Fprintln(logOut)
+	}
+}
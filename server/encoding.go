@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	identityEncoding = "identity"
+	gzipEncoding     = "gzip"
+	brotliEncoding   = "br"
+)
+
+// contentEncodings are the encodings the server may apply to content, in order of preference
+var contentEncodings []string
+
+// parseContentEncodings parses a comma separated list of supported content encodings
+func parseContentEncodings(spec string) ([]string, error) {
+	var encodings []string
+	for _, enc := range strings.Split(spec, ",") {
+		enc = strings.ToLower(strings.TrimSpace(enc))
+		switch enc {
+		case gzipEncoding, brotliEncoding:
+			encodings = append(encodings, enc)
+		default:
+			return nil, fmt.Errorf("unsupported content encoding '%s', expected gzip or br", enc)
+		}
+	}
+	return encodings, nil
+}
+
+// negotiateEncoding picks the acceptable encoding with the highest quality value in an Accept-Encoding
+// header, following RFC 9110 section 12.5.3. `*` matches any encoding not otherwise listed, and identity is
+// acceptable unless excluded with `identity;q=0` or `*;q=0`. When qualities are equal, supported encodings
+// are preferred in order over identity. Returns false if no encoding, including identity, is acceptable.
+func negotiateEncoding(acceptEncoding string, supported []string) (string, bool) {
+	qualities := parseAcceptEncoding(acceptEncoding)
+
+	quality := func(enc string) float64 {
+		if q, ok := qualities[enc]; ok {
+			return q
+		}
+		if q, ok := qualities["*"]; ok {
+			return q
+		}
+		if enc == identityEncoding {
+			return 1
+		}
+		return 0
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range supported {
+		if q := quality(enc); q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	// identity is checked separately rather than appended to supported, which is shared by requests
+	if q := quality(identityEncoding); q > bestQ {
+		best, bestQ = identityEncoding, q
+	}
+
+	return best, bestQ > 0
+}
+
+// acceptsGzip reports whether an Accept-Encoding header prefers gzip at least as much as unencoded content
+func acceptsGzip(acceptEncoding string) bool {
+	enc, _ := negotiateEncoding(acceptEncoding, []string{gzipEncoding})
+	return enc == gzipEncoding
+}
+
+// acceptEncoding returns the request's Accept-Encoding header lines joined into one comma separated list,
+// so codings sent across repeated header lines are negotiated the same as codings sent on one line
+func acceptEncoding(req *http.Request) string {
+	return strings.Join(req.Header.Values("Accept-Encoding"), ",")
+}
+
+// parseAcceptEncoding returns the quality value of each coding listed in an Accept-Encoding header.
+// Entries with malformed quality values are ignored.
+func parseAcceptEncoding(acceptEncoding string) map[string]float64 {
+	qualities := make(map[string]float64)
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(entry, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+
+		q, valid := 1.0, true
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(param, "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				valid = false
+				break
+			}
+			q = parsed
+		}
+
+		if valid {
+			qualities[coding] = q
+		}
+	}
+	return qualities
+}
+
+// maxGeneratedEncodeSize is the largest generated contents that are encoded. Encoded representations are
+// kept whole in memory, which would defeat generating larger contents as they're read.
+const maxGeneratedEncodeSize = 16 << 20
+
+// encodable reports whether the contents may be served with a content encoding
+func (c *inMemContents) encodable() bool {
+	return !c.generated || c.Len() <= maxGeneratedEncodeSize
+}
+
+// encode returns the contents compressed with the given encoding. Ranges of the result are ranges of
+// the encoded representation. Each encoding is compressed once and kept, as compressing the larger contents
+// on every request would dominate their response times. The lock isn't held while compressing, so requests
+// racing on a new encoding may each compress it, and the first result stored is kept.
+func (c *inMemContents) encode(encoding string) (*inMemContents, error) {
+	c.mu.Lock()
+	encoded, ok := c.encodings[encoding]
+	c.mu.Unlock()
+	if ok {
+		return encoded, nil
+	}
+
+	encoded, err := c.compress(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stored, ok := c.encodings[encoding]; ok {
+		return stored, nil
+	}
+	if c.encodings == nil {
+		c.encodings = make(map[string]*inMemContents)
+	}
+	c.encodings[encoding] = encoded
+	return encoded, nil
+}
+
+// compress compresses the contents with the given encoding
+func (c *inMemContents) compress(encoding string) (*inMemContents, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case gzipEncoding:
+		w = gzip.NewWriter(&buf)
+	case brotliEncoding:
+		w = brotli.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding '%s'", encoding)
+	}
+
+	if _, err := c.writeRange(0, c.Len(), w.Write); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &inMemContents{
+		mu:       &sync.Mutex{},
+		contents: buf.Bytes(),
+		modTime:  c.modTime,
+	}, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{gzipEncoding, brotliEncoding}
+
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+		ok             bool
+	}{
+		{acceptEncoding: "", encoding: identityEncoding, ok: true},
+		{acceptEncoding: "gzip", encoding: gzipEncoding, ok: true},
+		{acceptEncoding: "gzip, br", encoding: gzipEncoding, ok: true},
+		{acceptEncoding: "gzip;q=0.5, br;q=1.0", encoding: brotliEncoding, ok: true},
+		{acceptEncoding: "br;q=0.2, gzip;q=0.8", encoding: identityEncoding, ok: true},
+		{acceptEncoding: "br;q=0.2, gzip;q=0.8, identity;q=0.1", encoding: gzipEncoding, ok: true},
+		{acceptEncoding: "GZIP;Q=0.5, identity;q=0.6", encoding: identityEncoding, ok: true},
+		{acceptEncoding: "gzip;q=0, br;q=0", encoding: identityEncoding, ok: true},
+		{acceptEncoding: "*", encoding: gzipEncoding, ok: true},
+		{acceptEncoding: "gzip;q=0.1, *;q=0.5", encoding: brotliEncoding, ok: true},
+		{acceptEncoding: "*;q=0", ok: false},
+		{acceptEncoding: "identity;q=0", ok: false},
+		{acceptEncoding: "deflate, identity;q=0", ok: false},
+		{acceptEncoding: "br, identity;q=0", encoding: brotliEncoding, ok: true},
+		{acceptEncoding: "gzip;q=2, br", encoding: brotliEncoding, ok: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.acceptEncoding, func(t *testing.T) {
+			encoding, ok := negotiateEncoding(test.acceptEncoding, supported)
+			if ok != test.ok {
+				t.Fatalf("expected acceptable %t, got: %t", test.ok, ok)
+			}
+			if ok && encoding != test.encoding {
+				t.Errorf("expected encoding '%s', got: '%s'", test.encoding, encoding)
+			}
+		})
+	}
+}
+
+func TestNegotiateEncodingNotAcceptable(t *testing.T) {
+	setFlag(t, &contentEncodings, []string{gzipEncoding})
+
+	w := serveRequest(t, http.Header{"Accept-Encoding": {"br, identity;q=0"}})
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected status %d, got: %d", http.StatusNotAcceptable, w.Code)
+	}
+
+	w = serveRequest(t, http.Header{"Accept-Encoding": {"gzip, identity;q=0"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got: %d", http.StatusOK, w.Code)
+	}
+	if enc := w.Header().Get("Content-Encoding"); enc != gzipEncoding {
+		t.Errorf("expected content-encoding '%s', got: '%s'", gzipEncoding, enc)
+	}
+}
+
+func TestNegotiateEncodingConcurrent(t *testing.T) {
+	// spare capacity in the shared list of supported encodings must not be written by negotiation
+	supported := make([]string, 1, 4)
+	supported[0] = gzipEncoding
+
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 100; j++ {
+				negotiateEncoding("identity;q=0.5, gzip;q=0.1", supported)
+			}
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+
+	if supported[:cap(supported)][1] != "" {
+		t.Errorf("negotiation wrote past the supported encodings: %v", supported[:cap(supported)])
+	}
+}
+
+func TestAcceptEncodingLines(t *testing.T) {
+	setFlag(t, &contentEncodings, []string{gzipEncoding, brotliEncoding})
+
+	tests := []struct {
+		name     string
+		lines    []string
+		status   int
+		encoding string
+	}{
+		{name: "q-values", lines: []string{"gzip;q=0.5", "br;q=1.0"}, status: http.StatusOK, encoding: brotliEncoding},
+		{name: "lists", lines: []string{"deflate, gzip;q=0.9", "br;q=0.1, identity;q=0"}, status: http.StatusOK, encoding: gzipEncoding},
+		{name: "identity excluded", lines: []string{"deflate", "identity;q=0"}, status: http.StatusNotAcceptable},
+		{name: "wildcard", lines: []string{"gzip;q=0.2", "*;q=0.8"}, status: http.StatusOK, encoding: brotliEncoding},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			single := serveRequest(t, http.Header{"Accept-Encoding": {strings.Join(test.lines, ", ")}})
+			multiple := serveRequest(t, http.Header{"Accept-Encoding": test.lines})
+
+			for desc, w := range map[string]*httptest.ResponseRecorder{"single line": single, "multiple lines": multiple} {
+				if w.Code != test.status {
+					t.Errorf("%s: expected status %d, got: %d", desc, test.status, w.Code)
+				}
+				if enc := w.Header().Get("Content-Encoding"); enc != test.encoding {
+					t.Errorf("%s: expected content-encoding '%s', got: '%s'", desc, test.encoding, enc)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeGeneratedContents(t *testing.T) {
+	setFlag(t, &contentEncodings, []string{gzipEncoding})
+
+	tests := []struct {
+		path     string
+		encoding string
+	}{
+		{path: "/medium", encoding: gzipEncoding},
+		{path: "/large", encoding: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			contents := sizedContents[test.path]
+			req := httptest.NewRequest(http.MethodHead, test.path, nil)
+			req.Header.Set("Accept-Encoding", gzipEncoding)
+			w := httptest.NewRecorder()
+			serveContents(w, req, contents, false)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got: %d", http.StatusOK, w.Code)
+			}
+			if enc := w.Header().Get("Content-Encoding"); enc != test.encoding {
+				t.Errorf("expected content-encoding '%s', got: '%s'", test.encoding, enc)
+			}
+			if _, cached := contents.encodings[gzipEncoding]; cached != (test.encoding != "") {
+				t.Errorf("expected an encoding to be kept only for encoded contents, cached: %t", cached)
+			}
+		})
+	}
+}
+
+func TestEncodeConcurrent(t *testing.T) {
+	contents := newGeneratedContents(1, 64<<10)
+
+	results := make(chan *inMemContents)
+	for i := 0; i < 8; i++ {
+		go func() {
+			encoded, err := contents.encode(brotliEncoding)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- encoded
+		}()
+	}
+
+	first := <-results
+	for i := 1; i < 8; i++ {
+		if encoded := <-results; encoded != first {
+			t.Errorf("expected every request to get the stored encoding")
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var injectedErrorStatuses = []int{
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// maybeInjectError fails the request with a randomly chosen server error status at the configured
+// rate, returning true if it did.
+func maybeInjectError(w http.ResponseWriter, req *http.Request, rate float64) bool {
+	if rate <= 0 || rng.Float64() >= rate {
+		return false
+	}
+
+	statusCode := injectedErrorStatuses[rng.Intn(len(injectedErrorStatuses))]
+	fmt.Fprintln(logOut, "injecting error:", req.Method, req.URL.String(), "from", req.RemoteAddr)
+	fmt.Fprintln(logOut, "status-code:", statusCode)
+	fmt.Fprintln(logOut)
+
+	w.WriteHeader(statusCode)
+	return true
+}
+
+// headerErrors maps the canonical names of headers given in --error-on-header to the status requests
+// carrying them fail with
+var headerErrors map[string]int
+
+// parseErrorOnHeader parses a comma separated list of `header:status` pairs, ie `X-Dolt-Range:500`
+func parseErrorOnHeader(spec string) (map[string]int, error) {
+	errs := make(map[string]int)
+	for _, pair := range strings.Split(spec, ",") {
+		name, statusStr, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --error-on-header '%s', expected header:status", pair)
+		}
+		status, err := strconv.Atoi(strings.TrimSpace(statusStr))
+		if err != nil || status < 400 || status > 599 {
+			return nil, fmt.Errorf("invalid --error-on-header status '%s', expected 400 through 599", statusStr)
+		}
+		errs[http.CanonicalHeaderKey(name)] = status
+	}
+	return errs, nil
+}
+
+// failOnHeader fails the request with the status configured by --error-on-header for the first such
+// header it carries, returning true if it did.
+func failOnHeader(w http.ResponseWriter, req *http.Request) bool {
+	for name, statusCode := range headerErrors {
+		if _, ok := req.Header[name]; !ok {
+			continue
+		}
+
+		fmt.Fprintln(logOut, "failing request carrying header:", name)
+		fmt.Fprintln(logOut, "status-code:", statusCode)
+		fmt.Fprintln(logOut)
+
+		w.WriteHeader(statusCode)
+		return true
+	}
+	return false
+}
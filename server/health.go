@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// ready is set once the content and tls certificates are loaded and the servers start accepting
+// requests, and cleared while they shut down
+var ready atomic.Bool
+
+// serveHealth answers readiness checks with 200 once the server is ready and 503 otherwise. Checks are
+// not logged, as orchestrators poll them continuously.
+func serveHealth(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Add("Cache-Control", "no-store")
+
+	if !ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, "not ready\n")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "ready\n")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// idempotencyReplayHeader marks responses replayed from the idempotency cache
+const idempotencyReplayHeader = "Idempotency-Replayed"
+
+// cachedResponse is a response recorded for an Idempotency-Key
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// idempotencyCache holds the responses to requests carrying an Idempotency-Key until they expire
+type idempotencyCache struct {
+	mu        *sync.Mutex
+	responses map[string]*cachedResponse
+}
+
+var idempotentResponses = &idempotencyCache{
+	mu:        &sync.Mutex{},
+	responses: make(map[string]*cachedResponse),
+}
+
+func (c *idempotencyCache) get(key string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res, ok := c.responses[key]
+	if ok && time.Now().After(res.expires) {
+		delete(c.responses, key)
+		return nil, false
+	}
+	return res, ok
+}
+
+// put caches a response, dropping any that have expired
+func (c *idempotencyCache) put(key string, res *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, cached := range c.responses {
+		if now.After(cached.expires) {
+			delete(c.responses, k)
+		}
+	}
+	c.responses[key] = res
+}
+
+// replayIdempotent writes the cached response for the request's Idempotency-Key, returning false if
+// there is none
+func replayIdempotent(w http.ResponseWriter, key string) bool {
+	res, ok := idempotentResponses.get(key)
+	if !ok {
+		return false
+	}
+
+	fmt.Fprintln(logOut, "replaying response for idempotency key:", key)
+	fmt.Fprintln(logOut, "status-code:", res.status)
+	fmt.Fprintln(logOut)
+
+	for name, values := range res.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(idempotencyReplayHeader, "true")
+	w.WriteHeader(res.status)
+
+	if _, err := w.Write(res.body); err != nil {
+		fmt.Fprintln(logOut, "failed to write replayed response:", err.Error())
+		fmt.Fprintln(logOut)
+	}
+	return true
+}
+
+// idempotencyRecorder captures the status, headers and body of a response as it is written
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	writeErr error
+}
+
+func (r *idempotencyRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+		r.header = r.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.body.Write(b[:n])
+	if err != nil && r.writeErr == nil {
+		r.writeErr = err
+	}
+	return n, err
+}
+
+func (r *idempotencyRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// store caches the recorded response for key, if one was written in full. Server errors and responses cut
+// short, by a failed write or a body shorter than its Content-Length, are not cached, so a retry gets a
+// fresh response rather than a replay of the failure.
+func (r *idempotencyRecorder) store(key string) {
+	if r.status == 0 {
+		return
+	}
+
+	reason := ""
+	if r.status >= http.StatusInternalServerError {
+		reason = fmt.Sprintf("status %d", r.status)
+	} else if r.writeErr != nil {
+		reason = "write failed: " + r.writeErr.Error()
+	} else if contentLength := r.header.Get("Content-Length"); contentLength != "" && contentLength != strconv.Itoa(r.body.Len()) {
+		reason = fmt.Sprintf("wrote %d of %s bytes", r.body.Len(), contentLength)
+	}
+	if reason != "" {
+		fmt.Fprintln(logOut, "not caching response for idempotency key:", key, reason)
+		return
+	}
+	idempotentResponses.put(key, &cachedResponse{
+		status:  r.status,
+		header:  r.header,
+		body:    r.body.Bytes(),
+		expires: time.Now().Add(*idempotencyTTL),
+	})
+}
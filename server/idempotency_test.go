@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIdempotencyInjectedErrorsNotCached(t *testing.T) {
+	header := http.Header{"Idempotency-Key": {"injected-error"}}
+
+	setFlag(t, errorRate, 1.0)
+	w := serveRequest(t, header)
+	if w.Code < http.StatusInternalServerError {
+		t.Fatalf("expected an injected server error, got: %d", w.Code)
+	}
+
+	*errorRate = 0
+	w = serveRequest(t, header)
+	if w.Code != http.StatusOK || w.Header().Get(idempotencyReplayHeader) != "" {
+		t.Fatalf("expected a fresh 200 after the injected error, got: %d replayed: '%s'", w.Code, w.Header().Get(idempotencyReplayHeader))
+	}
+
+	w = serveRequest(t, header)
+	if w.Code != http.StatusOK || w.Header().Get(idempotencyReplayHeader) != "true" {
+		t.Fatalf("expected the completed 200 to be replayed, got: %d replayed: '%s'", w.Code, w.Header().Get(idempotencyReplayHeader))
+	}
+	if w.Body.Len() != builtInSize {
+		t.Errorf("expected the replay to hold all %d bytes, got: %d", builtInSize, w.Body.Len())
+	}
+}
+
+func TestIdempotencyHeaderErrorsNotCached(t *testing.T) {
+	setFlag(t, &headerErrors, map[string]int{"X-Fail": http.StatusForbidden})
+
+	w := serveRequest(t, http.Header{"Idempotency-Key": {"header-error"}, "X-Fail": {"1"}})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d, got: %d", http.StatusForbidden, w.Code)
+	}
+	if _, ok := idempotentResponses.get("header-error"); ok {
+		t.Errorf("expected the --error-on-header response not to be cached")
+	}
+}
+
+// failingWriter fails every body write, as writes to a disconnected client do
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func TestIdempotencyIncompleteResponsesNotCached(t *testing.T) {
+	t.Run("failed write", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Idempotency-Key", "failed-write")
+		serveContents(failingWriter{httptest.NewRecorder()}, req, newContents(), false)
+
+		if _, ok := idempotentResponses.get("failed-write"); ok {
+			t.Errorf("expected the failed response not to be cached")
+		}
+	})
+
+	t.Run("short body", func(t *testing.T) {
+		rec := &idempotencyRecorder{ResponseWriter: httptest.NewRecorder()}
+		rec.Header().Set("Content-Length", "10")
+		rec.WriteHeader(http.StatusOK)
+		rec.Write([]byte("short"))
+		rec.store("short-body")
+
+		if _, ok := idempotentResponses.get("short-body"); ok {
+			t.Errorf("expected the truncated response not to be cached")
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// inflight counts the content requests currently being served, and shed the requests rejected with 503
+// because --max-inflight were already being served
+var inflight, shed atomic.Int64
+
+// acquireInflight counts a request as in flight, or sheds it with a 503 if --max-inflight requests are
+// already being served, returning false. Acquired requests must call releaseInflight when done.
+func acquireInflight(w http.ResponseWriter) bool {
+	max := int64(*maxInflight)
+	if active := inflight.Add(1); max > 0 && active > max {
+		inflight.Add(-1)
+		shed.Add(1)
+
+		fmt.Fprintln(logOut, "shedding request, in flight:", active-1)
+		fmt.Fprintln(logOut, "status-code:", http.StatusServiceUnavailable)
+		fmt.Fprintln(logOut)
+
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+func releaseInflight() {
+	inflight.Add(-1)
+}
+
+// writeInflightMetrics writes the in flight gauges and shed counter in the prometheus text exposition format
+func writeInflightMetrics(buf *bytes.Buffer) {
+	buf.WriteString("# HELP headers_tester_inflight_requests Content requests currently being served.\n")
+	buf.WriteString("# TYPE headers_tester_inflight_requests gauge\n")
+	fmt.Fprintf(buf, "headers_tester_inflight_requests %d\n", inflight.Load())
+
+	buf.WriteString("# HELP headers_tester_max_inflight_requests Content requests served at once before shedding, 0 if unlimited.\n")
+	buf.WriteString("# TYPE headers_tester_max_inflight_requests gauge\n")
+	fmt.Fprintf(buf, "headers_tester_max_inflight_requests %d\n", *maxInflight)
+
+	buf.WriteString("# HELP headers_tester_shed_requests_total Content requests rejected with 503 by --max-inflight.\n")
+	buf.WriteString("# TYPE headers_tester_shed_requests_total counter\n")
+	fmt.Fprintf(buf, "headers_tester_shed_requests_total %d\n", shed.Load())
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// jitterChunkSize is the size of the pieces --jitter-writes splits response bodies into
+const jitterChunkSize = 1024
+
+// jitterWriter writes response bodies in small flushed chunks separated by random delays of up to
+// --jitter-delay, occasionally stalling for --jitter-stall instead, modeling jittery delivery over a lossy
+// link. Unlike throttledWriter the gaps between chunks are irregular. Delays are drawn from the seeded rng.
+type jitterWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+}
+
+func (j *jitterWriter) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		end := written + jitterChunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+
+		n, err := j.ResponseWriter.Write(b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		j.Flush()
+
+		if written < len(b) {
+			if err = sleepContext(j.ctx, jitterDelay()); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (j *jitterWriter) Flush() {
+	if f, ok := j.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// jitterDelay returns the delay before the next chunk, a stall with probability --jitter-stall-rate and
+// otherwise uniformly distributed up to --jitter-delay
+func jitterDelay() time.Duration {
+	if rng.Float64() < *jitterStallRate {
+		return *jitterStall
+	}
+	return time.Duration(rng.Float64() * float64(*jitterMaxDelay))
+}
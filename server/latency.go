@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// latencyDistribution samples the delay injected before a request is served
+type latencyDistribution interface {
+	sample(r *lockedRand) time.Duration
+}
+
+type normalLatency struct {
+	mean   time.Duration
+	stddev time.Duration
+}
+
+func (n normalLatency) sample(r *lockedRand) time.Duration {
+	return nonNegative(time.Duration(r.NormFloat64()*float64(n.stddev)) + n.mean)
+}
+
+type exponentialLatency struct {
+	mean time.Duration
+}
+
+func (e exponentialLatency) sample(r *lockedRand) time.Duration {
+	return nonNegative(time.Duration(r.ExpFloat64() * float64(e.mean)))
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// parseLatencyDistribution parses specs of the form `normal:mean=50ms,stddev=20ms` or `exponential:mean=30ms`
+func parseLatencyDistribution(spec string) (latencyDistribution, error) {
+	name, paramStr, _ := strings.Cut(spec, ":")
+
+	params := make(map[string]time.Duration)
+	for _, param := range strings.Split(paramStr, ",") {
+		if strings.TrimSpace(param) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid latency distribution parameter '%s'", param)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid latency distribution parameter '%s': %w", param, err)
+		}
+		params[strings.TrimSpace(key)] = d
+	}
+
+	required := func(keys ...string) error {
+		for _, key := range keys {
+			if _, ok := params[key]; !ok {
+				return fmt.Errorf("%s latency distribution requires '%s'", name, key)
+			}
+		}
+		return nil
+	}
+
+	switch name {
+	case "normal":
+		if err := required("mean", "stddev"); err != nil {
+			return nil, err
+		}
+		return normalLatency{mean: params["mean"], stddev: params["stddev"]}, nil
+	case "exponential":
+		if err := required("mean"); err != nil {
+			return nil, err
+		}
+		return exponentialLatency{mean: params["mean"]}, nil
+	default:
+		return nil, fmt.Errorf("unknown latency distribution '%s', expected normal or exponential", name)
+	}
+}
+
+// sleepContext waits for d, returning early with the context's error if it is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// headerDelayWriter delays the status line and headers of a response until delay has passed, after
+// which the body is written without further delay.
+type headerDelayWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	delay       time.Duration
+	wroteHeader bool
+}
+
+func (w *headerDelayWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		fmt.Fprintln(logOut, "delaying headers:", w.delay)
+		if err := sleepContext(w.ctx, w.delay); err != nil {
+			fmt.Fprintln(logOut, "header delay interrupted:", err.Error())
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *headerDelayWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerDelayWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
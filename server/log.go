@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// logOut receives all server log output, stdout unless --log-file is set
+var logOut io.Writer = os.Stdout
+
+// openLog directs log output to --log-file, also writing it to stdout with --log-stdout. With --log-max-size
+// the file is rotated once it reaches that size. The returned closer should be closed once the server stops.
+func openLog() (io.Closer, error) {
+	if *logFile == "" {
+		return nil, nil
+	}
+
+	var maxSize int64
+	if *logMaxSize != "" {
+		var err error
+		maxSize, err = parseByteSize(*logMaxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *logMaxFiles < 0 {
+		return nil, errors.New("--log-max-files must not be negative")
+	}
+
+	f, err := openRotatingFile(*logFile, maxSize, *logMaxFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open --log-file %s: %w", *logFile, err)
+	}
+
+	logOut = f
+	if *logStdout {
+		logOut = io.MultiWriter(f, os.Stdout)
+	}
+	return f, nil
+}
+
+// parseByteSize parses a size such as `512`, `64KB` or `10MB`, using binary multiples
+func parseByteSize(spec string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(spec))
+	multiple := int64(1)
+	for _, unit := range []struct {
+		suffix   string
+		multiple int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiple = unit.multiple
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size '%s', expected a positive number of bytes, KB, MB or GB", spec)
+	}
+	return n * multiple, nil
+}
+
+// rotatingFile appends to a log file, rolling it over to numbered backups `path.1` through `path.N` once
+// writing would grow it past maxSize. A maxSize of 0 never rotates.
+type rotatingFile struct {
+	mu       *sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		mu:       &sync.Mutex{},
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate closes the current file, shifts the backups up by one, dropping the oldest, and reopens the path
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	if r.maxFiles == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+
+	for i := r.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
@@ -7,7 +7,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,216 +17,827 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/dolthub/headers_tester/pattern"
+	"github.com/dolthub/headers_tester/version"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 )
 
 var port = flag.Int("port", 1709, "http listening port")
 var securePort = flag.Int("secure-port", 443, "https listening port")
+var noRangePort = flag.Int("no-range-port", 0, "port of an additional http server that ignores ranges and sends 'Accept-Ranges: none'. 0 doesn't start it")
 var certFile = flag.String("tls-cert-file", "", "path to tls cert file")
 var keyFile = flag.String("tls-key-file", "", "path to tls key file")
+var ocspResponseFile = flag.String("ocsp-response-file", "", "path to a DER encoded OCSP response stapled to https handshakes")
 var verbose = flag.Bool("verbose", false, "log verbosely")
+var maxConnsPerIP = flag.Int("max-conns-per-ip", 0, "maximum concurrent connections per client ip, 0 for no limit")
+var tarpit = flag.Bool("tarpit", false, "trickle response bodies a byte at a time and never complete them")
+var tarpitInterval = flag.Duration("tarpit-interval", 5*time.Second, "interval between bytes written in --tarpit mode")
+var latencyDist = flag.String("latency-distribution", "", "distribution of latency injected before serving, ie 'normal:mean=50ms,stddev=20ms' or 'exponential:mean=30ms'")
+var headerDelay = flag.Duration("header-delay", 0, "delay before sending the response status line and headers")
+var errorRate = flag.Float64("error-rate", 0, "fraction of requests, between 0 and 1, failed with a random 500, 502, 503 or 504")
+var errorOnHeader = flag.String("error-on-header", "", "comma separated header:status pairs, requests carrying the header fail with the status, ie 'X-Dolt-Range:500'")
+var keepAliveTimeout = flag.Duration("keep-alive-timeout", 0, "idle keep-alive timeout advertised in a Keep-Alive header on http/1.x responses")
+var disableKeepAlive = flag.Bool("disable-keepalive", false, "close connections after every response")
+var tcpKeepAlive = flag.Duration("tcp-keepalive", 15*time.Second, "interval between tcp keepalive probes on accepted connections. 0 disables keepalive probes")
+var tcpNoDelay = flag.Bool("tcp-nodelay", true, "set TCP_NODELAY on accepted connections, disabling Nagle's algorithm")
+var closeRate = flag.Float64("close-rate", 0, "fraction of http/1.x responses, between 0 and 1, sent with 'Connection: close' to close the keep-alive connection")
+var availableRangesSpec = flag.String("available-ranges", "", "comma separated byte ranges of content the server has, ie '0-999,2000-2999'. Default all content")
+var rangePrecedenceSpec = flag.String("range-precedence", defaultRangePrecedence, "comma separated order in which range sources are honored when several are present")
+var exposeTLSInfo = flag.Bool("expose-tls-info", false, "add X-TLS-Version, X-TLS-Cipher and X-TLS-Client-Cert headers to https responses")
+var tls13Only = flag.Bool("tls13-only", false, "only accept TLS 1.3 connections on the https server, failing the handshake of older clients")
+var tlsCurves = flag.String("tls-curves", "x25519,p521,p384,p256", "comma separated elliptic curves offered by the https server in order of preference: x25519, p256, p384 or p521")
+var alpnProtocols = flag.String("alpn", "", "comma separated alpn protocols advertised by the https server, ie 'h2,http/1.1'. Default h2 and http/1.1")
+var suffixOverflow = flag.String("suffix-overflow", suffixOverflowClamp, "handling of suffix ranges longer than the content, clamp serves all content and reject responds 416")
+var contentEncodingSpec = flag.String("content-encoding", "", "comma separated content encodings the server may apply when accepted by the client, gzip or br")
+var jitterWrites = flag.Bool("jitter-writes", false, "write response bodies in small flushed chunks separated by random delays and occasional stalls, modeling a lossy link")
+var jitterMaxDelay = flag.Duration("jitter-delay", 10*time.Millisecond, "longest random delay between --jitter-writes chunks")
+var jitterStall = flag.Duration("jitter-stall", 250*time.Millisecond, "delay of the occasional --jitter-writes stall")
+var jitterStallRate = flag.Float64("jitter-stall-rate", 0.05, "fraction of --jitter-writes chunks, between 0 and 1, followed by a stall instead of a random delay")
+var writeChunk = flag.Int("write-chunk", 0, "write response bodies in chunks of this many bytes, flushing after each. 0 writes bodies at once")
+var maxBodySizeSpec = flag.String("max-body-size", "64MB", "largest request body accepted by /batch and /upload, ie '1MB'. Larger bodies are answered with 413")
+var responseBuffer = flag.String("response-buffer", "", "size of the buffer response bodies are written through, ie '64KB'. Ignored with --write-chunk")
+var always206OnRange = flag.Bool("always-206-on-range", false, "answer every satisfiable range with 206 and a Content-Range, even one spanning all content. The default behavior, made explicit")
+var prefer200OnFullRange = flag.Bool("prefer-200-on-full-range", false, "answer a range spanning all content, ie 'bytes=0-', with 200 and the full content")
+var rangeAlignment = flag.Int64("range-alignment", 0, "widen single ranges outward to multiples of this many bytes, ie 512, modeling block aligned storage. 0 serves ranges as requested")
+var maxRangeSegments = flag.Int("max-range-segments", 128, "most ranges a single Range header may list before the request is rejected with 400. 0 allows any number")
+var coalesceRanges = flag.Bool("coalesce-ranges", false, "merge overlapping and adjacent ranges of a multi-range request, answering with a single range when they merge into one")
+var statusJitter = flag.Float64("response-jitter-status", 0, "fraction of content requests, between 0 and 1, answered with the unexpected status: all content as a 206 range, or a 200 for range requests")
+var fakeTotal = flag.Int64("fake-total", 0, "total size reported in the Content-Range of 206 responses instead of the content's actual size. 0 reports the actual size")
+var discardBody = flag.Bool("discard-body", false, "respond with the usual status and headers but an empty body, for benchmarking header and range handling only")
+var requireDoltAuth = flag.String("require-dolt-auth", "", "token content requests must send in an X-Dolt-Auth header, others are answered with 403")
+var maxInflight = flag.Int("max-inflight", 0, "content requests served at once, more are shed with 503 and Retry-After. 0 is unlimited")
+var earlyHints = flag.Bool("early-hints", false, "send a '103 Early Hints' interim response with a Link preload header before content responses")
+var idempotencyTTL = flag.Duration("idempotency-ttl", 5*time.Minute, "time the response to a request with an Idempotency-Key is replayed to repeated requests with the key. 0 disables replays")
+var weakETag = flag.Bool("weak-etag", false, "send a weak etag, ie 'W/\"...\"', which never satisfies If-Match or If-Range")
+var fixedDate = flag.String("fixed-date", "", "constant Date header sent with every response instead of the current time, ie 'Mon, 02 Jan 2006 15:04:05 GMT'")
+var noDate = flag.Bool("no-date", false, "send responses without a Date header")
+var volatileETag = flag.Bool("volatile-etag", false, "send a new random etag with every response, so conditional requests never match")
+var logFile = flag.String("log-file", "", "file server logs are appended to instead of stdout")
+var logStdout = flag.Bool("log-stdout", false, "with --log-file, also write server logs to stdout")
+var logMaxSize = flag.String("log-max-size", "", "size at which --log-file is rotated, ie '10MB'. Unset never rotates")
+var logMaxFiles = flag.Int("log-max-files", 5, "number of rotated --log-file backups kept")
+var shutdownMode = flag.String("shutdown-mode", shutdownModeGraceful, "shutdown on SIGINT or SIGTERM, graceful drains in-flight requests and immediate drops them")
+var contentDir = flag.String("content-dir", "", "directory whose files are served at /<name>, with a json listing of them at /")
+var contentDirRecursive = flag.Bool("content-dir-recursive", false, "also serve the files in subdirectories of --content-dir")
+var patternSize = flag.String("pattern-size", "", "serve this many bytes of deterministic content generated from --pattern-seed instead of the built in text, ie '10MB'")
+var patternSeed = flag.Int64("pattern-seed", 0, "seed the --pattern-size content is generated from")
+var banner = flag.String("banner", bannerText, "startup output once both servers are listening, text or json")
+var cpuProfile = flag.String("cpu-profile", "", "file a pprof cpu profile is written to, covering from startup until shutdown")
+var memProfile = flag.String("mem-profile", "", "file a pprof heap profile is written to on shutdown")
+var pprofAddr = flag.String("pprof-addr", "", "address of a separate server exposing the net/http/pprof handlers at /debug/pprof/, ie ':6060'")
+var seed = flag.Int64("seed", 0, "seed for randomized behavior, 0 seeds from the current time")
+var configFile = flag.String("config", "", "path to a file of flag settings, one 'name=value' per line, reapplied on SIGHUP")
+var printVersion = flag.Bool("version", false, "print version information and exit")
 
 var errInvalidRange = errors.New("invalid range")
 var errInvalidRangeStr = errors.New("invalid range string")
+var errUnsatisfiableRange = errors.New("unsatisfiable range")
+
+const (
+	suffixOverflowClamp  = "clamp"
+	suffixOverflowReject = "reject"
+)
+
+const (
+	shutdownModeGraceful  = "graceful"
+	shutdownModeImmediate = "immediate"
+)
+
+var rng *lockedRand
+var latency latencyDistribution
 
 func main() {
 	flag.Parse()
 
-	if *port == 0 {
-		fmt.Println("must supply --port")
+	if *printVersion {
+		version.Print("server")
+		return
+	}
+
+	if *configFile != "" {
+		if err := applyConfig(*configFile); err != nil {
+			fmt.Fprintln(logOut, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	f, err := openLog()
+	if err != nil {
+		fmt.Fprintln(logOut, err.Error())
 		os.Exit(1)
 	}
+	if f != nil {
+		defer f.Close()
+	}
 
-	if *securePort == 0 {
-		fmt.Println("must supply --secure-port")
+	if err = configure(); err != nil {
+		fmt.Fprintln(logOut, err.Error())
 		os.Exit(1)
 	}
 
-	if *certFile == "" {
-		fmt.Println("must supply --tls-cert-file")
+	stopProfiles, err := startProfiles()
+	if err != nil {
+		fmt.Fprintln(logOut, err.Error())
 		os.Exit(1)
 	}
 
-	if *keyFile == "" {
-		fmt.Println("must supply --tls-key-file")
+	var pprofSrv *http.Server
+	if *pprofAddr != "" {
+		pprofSrv, err = startPprofServer(*pprofAddr)
+		if err != nil {
+			stopProfiles()
+			fmt.Fprintln(logOut, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	err = run()
+	if pprofSrv != nil {
+		shutdownPprofServer(pprofSrv)
+	}
+	stopProfiles()
+	if err != nil {
+		fmt.Fprintln(logOut, err.Error())
 		os.Exit(1)
 	}
+}
+
+// configure validates the flags and prepares the state derived from them
+func configure() error {
+	if *port == 0 {
+		return errors.New("must supply --port")
+	}
+
+	if *securePort == 0 {
+		return errors.New("must supply --secure-port")
+	}
+
+	if *certFile == "" {
+		return errors.New("must supply --tls-cert-file")
+	}
+
+	if *keyFile == "" {
+		return errors.New("must supply --tls-key-file")
+	}
+
+	if *errorRate < 0 || *errorRate > 1 {
+		return errors.New("--error-rate must be between 0 and 1")
+	}
+
+	if *statusJitter < 0 || *statusJitter > 1 {
+		return errors.New("--response-jitter-status must be between 0 and 1")
+	}
+
+	if *closeRate < 0 || *closeRate > 1 {
+		return errors.New("--close-rate must be between 0 and 1")
+	}
+
+	if *tarpitInterval <= 0 {
+		return errors.New("--tarpit-interval must be greater than 0")
+	}
+
+	if *noRangePort < 0 {
+		return errors.New("--no-range-port must not be negative")
+	}
+
+	if *tcpKeepAlive < 0 {
+		return errors.New("--tcp-keepalive must not be negative")
+	}
+
+	if *jitterStallRate < 0 || *jitterStallRate > 1 {
+		return errors.New("--jitter-stall-rate must be between 0 and 1")
+	}
+
+	if *jitterMaxDelay < 0 || *jitterStall < 0 {
+		return errors.New("--jitter-delay and --jitter-stall must not be negative")
+	}
+
+	if *suffixOverflow != suffixOverflowClamp && *suffixOverflow != suffixOverflowReject {
+		return errors.New("--suffix-overflow must be clamp or reject")
+	}
+
+	if *banner != bannerText && *banner != bannerJSON {
+		return errors.New("--banner must be text or json")
+	}
+
+	if *maxInflight < 0 {
+		return errors.New("--max-inflight must not be negative")
+	}
+
+	if *rangeAlignment < 0 {
+		return errors.New("--range-alignment must not be negative")
+	}
+
+	if *maxRangeSegments < 0 {
+		return errors.New("--max-range-segments must not be negative")
+	}
+
+	if *fakeTotal < 0 {
+		return errors.New("--fake-total must not be negative")
+	}
+
+	if *always206OnRange && *prefer200OnFullRange {
+		return errors.New("--always-206-on-range can't be used with --prefer-200-on-full-range")
+	}
+
+	if *fixedDate != "" && *noDate {
+		return errors.New("--fixed-date can't be used with --no-date")
+	}
+
+	if *shutdownMode != shutdownModeGraceful && *shutdownMode != shutdownModeImmediate {
+		return errors.New("--shutdown-mode must be graceful or immediate")
+	}
+
+	var err error
+	rangePrecedence, err = parseRangePrecedence(*rangePrecedenceSpec)
+	if err != nil {
+		return err
+	}
+
+	curvePreferences, err = parseTLSCurves(*tlsCurves)
+	if err != nil {
+		return err
+	}
+
+	headerErrors = nil
+	if *errorOnHeader != "" {
+		headerErrors, err = parseErrorOnHeader(*errorOnHeader)
+		if err != nil {
+			return err
+		}
+	}
 
-	httpSrv := getHttpServer(*port, *verbose)
+	fixedDateHeader = ""
+	if *fixedDate != "" {
+		fixedDateHeader, err = parseFixedDate(*fixedDate)
+		if err != nil {
+			return fmt.Errorf("invalid --fixed-date: %w", err)
+		}
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	fmt.Fprintln(logOut, "using seed:", *seed)
+	rng = newLockedRand(*seed)
+
+	latency = nil
+	if *latencyDist != "" {
+		latency, err = parseLatencyDistribution(*latencyDist)
+		if err != nil {
+			return err
+		}
+	}
+
+	contentEncodings = nil
+	if *contentEncodingSpec != "" {
+		contentEncodings, err = parseContentEncodings(*contentEncodingSpec)
+		if err != nil {
+			return err
+		}
+	}
+
+	maxBodySize, err = parseByteSize(*maxBodySizeSpec)
+	if err != nil {
+		return err
+	}
+
+	responseBufferSize = 0
+	if *responseBuffer != "" {
+		size, err := parseByteSize(*responseBuffer)
+		if err != nil {
+			return err
+		}
+		responseBufferSize = int(size)
+	}
+
+	sizedContents = newSizedContents()
+
+	patternContent = nil
+	if *patternSize != "" {
+		size, err := parseByteSize(*patternSize)
+		if err != nil {
+			return err
+		}
+		patternContent = make([]byte, size)
+		pattern.Fill(*patternSeed, patternContent, 0)
+		fmt.Fprintln(logOut, "generated pattern content:", size, "seed:", *patternSeed)
+	}
+	builtInContents = newContents()
+
+	var objects map[string]*inMemContents
+	if *contentDir != "" {
+		objects, err = loadContentDir(*contentDir, *contentDirRecursive)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(logOut, "loaded objects from content dir:", len(objects))
+	}
+	contentObjects.Store(&objects)
+
+	availableRanges = nil
+	if *availableRangesSpec != "" {
+		availableRanges, err = parseAvailableRanges(*availableRangesSpec)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// namedServer is a server along with the name it is logged as, and whether it serves tls
+type namedServer struct {
+	name string
+	srv  *http.Server
+	tls  bool
+}
+
+// newServers builds the http and https servers from the current flags, along with the http server that
+// ignores ranges when --no-range-port is set
+func newServers() ([]namedServer, error) {
+	httpSrv := getHttpServer(*port, *verbose, true)
 
 	httpsSrv, err := getHttpsServer(*securePort, *verbose)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	// loading the certificate up front means the server is fully prepared once it starts listening
+	cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	if *ocspResponseFile != "" {
+		cert.OCSPStaple, err = loadOCSPStaple(*ocspResponseFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	httpsSrv.TLSConfig.Certificates = []tls.Certificate{cert}
+
+	servers := []namedServer{
+		{name: "http", srv: httpSrv},
+		{name: "https", srv: httpsSrv, tls: true},
+	}
+	if *noRangePort > 0 {
+		servers = append(servers, namedServer{name: "no-range http", srv: getHttpServer(*noRangePort, *verbose, false)})
+	}
+
+	var limiter *connLimiter
+	if *maxConnsPerIP > 0 {
+		limiter = newConnLimiter(*maxConnsPerIP)
+	}
+
+	for _, s := range servers {
+		if *keepAliveTimeout > 0 {
+			s.srv.IdleTimeout = *keepAliveTimeout
+		}
+
+		if *disableKeepAlive {
+			s.srv.SetKeepAlivesEnabled(false)
+		}
+
+		if limiter != nil {
+			s.srv.ConnState = limiter.connState
+		}
 	}
 
+	return servers, nil
+}
+
+// run serves until a shutdown signal is received or a server fails. On SIGHUP the servers are drained,
+// the --config file is reapplied and the servers are rebuilt with the refreshed settings. On SIGUSR1 the
+// --content-dir is reloaded without interrupting the servers.
+func run() error {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
 
-	go func() {
-		<-quit
-		signal.Stop(quit)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
 
-		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-		defer cancel()
+	usr1 := make(chan os.Signal, 1)
+	notifyContentReload(usr1)
+	defer signal.Stop(usr1)
+	go watchContentReload(usr1)
 
-		fmt.Println("http server is shutting down")
-		if err := httpSrv.Shutdown(ctx); err != nil {
-			fmt.Println("failed to shutdown http server", err.Error())
+	for {
+		servers, err := newServers()
+		if err != nil {
+			return err
 		}
 
-		fmt.Println("https server is shutting down")
-		if err := httpsSrv.Shutdown(ctx); err != nil {
-			fmt.Println("failed to shutdown https server", err.Error())
+		reload, err := serve(servers, quit, hup)
+		if err != nil || !reload {
+			printStatusCounts()
+			return err
 		}
 
-	}()
+		fmt.Fprintln(logOut, "reloading configuration")
+		if err = reloadConfig(); err != nil {
+			fmt.Fprintln(logOut, "failed to reload configuration, keeping previous settings:", err.Error())
+		}
+	}
+}
 
-	var wg sync.WaitGroup
+// serve runs the servers until a quit or reload signal is received or any server fails, in which case all
+// are shut down. Returns true if the servers were shut down to be reloaded.
+func serve(servers []namedServer, quit, reload <-chan os.Signal) (bool, error) {
+	// request contexts derive from ctx so long-running responses are released on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		fmt.Println("Serving http on :", *port)
-		if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Println("Error serving http server:", err.Error())
-		}
-	}()
+	baseContext := func(net.Listener) context.Context {
+		return ctx
+	}
+
+	// all listeners are bound before serving, so the server is only reported ready once it can accept
+	// connections on every port
+	var lns []net.Listener
+	for _, s := range servers {
+		s.srv.BaseContext = baseContext
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		fmt.Println("Serving https on :", *securePort)
-		if err := httpsSrv.ListenAndServeTLS(*certFile, *keyFile); err != nil && err != http.ErrServerClosed {
-			fmt.Println("Error serving https server:", err.Error())
+		ln, err := listen(s.srv.Addr)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return false, fmt.Errorf("error serving %s server: %w", s.name, err)
 		}
-	}()
+		lns = append(lns, ln)
+	}
+
+	errs := make(chan error, len(servers))
+
+	var wg sync.WaitGroup
+
+	for i, s := range servers {
+		wg.Add(1)
+		go func(s namedServer, ln net.Listener) {
+			defer wg.Done()
+			var err error
+			if s.tls {
+				err = s.srv.ServeTLS(ln, "", "")
+			} else {
+				err = s.srv.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				errs <- fmt.Errorf("error serving %s server: %w", s.name, err)
+			}
+		}(s, lns[i])
+	}
 
+	var noRangeAddr net.Addr
+	if len(lns) > 2 {
+		noRangeAddr = lns[2].Addr()
+	}
+	printBanner(lns[0].Addr(), lns[1].Addr(), noRangeAddr)
+	ready.Store(true)
+
+	var reloading, immediate bool
+	var serveErr error
+	select {
+	case <-quit:
+		immediate = *shutdownMode == shutdownModeImmediate
+	case <-reload:
+		reloading = true
+	case serveErr = <-errs:
+	}
+
+	ready.Store(false)
+	cancel()
+	if immediate {
+		closeNow(servers)
+	} else {
+		shutdown(servers)
+	}
 	wg.Wait()
 
+	return reloading, serveErr
 }
 
-func serveContents(w http.ResponseWriter, req *http.Request, contents *inMemContents, vbs bool) {
-	if req.Method != http.MethodGet {
-		w.WriteHeader(http.StatusBadRequest)
-		_, err := io.WriteString(w, "only GET requests supported.")
-		if err != nil {
-			fmt.Println(err.Error())
+func shutdown(servers []namedServer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	for _, s := range servers {
+		fmt.Fprintln(logOut, s.name, "server is shutting down")
+		if err := s.srv.Shutdown(ctx); err != nil {
+			fmt.Fprintln(logOut, "failed to shutdown", s.name, "server", err.Error())
 		}
-		fmt.Println("received unsupported request method")
+	}
+}
+
+// closeNow closes the servers without draining, dropping in-flight connections
+func closeNow(servers []namedServer) {
+	for _, s := range servers {
+		fmt.Fprintln(logOut, s.name, "server is closing immediately")
+		if err := s.srv.Close(); err != nil {
+			fmt.Fprintln(logOut, "failed to close", s.name, "server", err.Error())
+		}
+	}
+}
+
+func serveContents(w http.ResponseWriter, req *http.Request, contents *inMemContents, vbs bool) {
+	fmt.Fprintln(logOut, "received request")
+
+	if !checkDoltAuth(w, req) {
+		return
+	}
+
+	if !acquireInflight(w) {
 		return
 	}
+	defer releaseInflight()
 
-	fmt.Println("received request")
+	if *earlyHints {
+		sendEarlyHints(w, req)
+	}
+
+	if vbs && req.TLS != nil {
+		fmt.Fprintln(logOut, "alpn negotiated protocol:", alpnProtocol(req.TLS.NegotiatedProtocol))
+	}
+
+	stw := newServerTimingWriter(w)
+	defer stw.logWriteDuration()
+	w = stw
+
+	if *headerDelay > 0 {
+		w = &headerDelayWriter{ResponseWriter: w, ctx: req.Context(), delay: *headerDelay}
+	}
+
+	if *jitterWrites {
+		w = &jitterWriter{ResponseWriter: w, ctx: req.Context()}
+	}
+
+	if *discardBody {
+		w = &discardBodyWriter{ResponseWriter: w}
+	}
+
+	// trailers are only sent to clients that indicate support for them, and never with --discard-body, whose
+	// empty bodies have no digest to send and aren't chunked to carry one
+	if acceptsTrailers(req) && !*discardBody {
+		tw := newTrailerWriter(w)
+		defer tw.writeTrailers()
+		w = tw
+	}
 
 	w.Header().Add("Accept-Ranges", "bytes")
 
-	// handle range header
-	rangeHeader := req.Header.Get("Range")
-	if rangeHeader == "" {
-		rangeHeader = req.Header.Get("range")
+	// Keep-Alive is a connection specific header that is not allowed in http2 responses
+	if *keepAliveTimeout > 0 && req.ProtoMajor == 1 {
+		w.Header().Add("Keep-Alive", fmt.Sprintf("timeout=%d", int(keepAliveTimeout.Seconds())))
+	}
+
+	// the seeded rng makes the connections closed reproducible, connection headers aren't allowed in http2
+	if *closeRate > 0 && req.ProtoMajor == 1 && rng.Float64() < *closeRate {
+		fmt.Fprintln(logOut, "closing connection after response")
+		w.Header().Set("Connection", "close")
+	}
+
+	if maybeInjectError(w, req, *errorRate) {
+		return
 	}
-	if rangeHeader != "" {
-		fmt.Println("header: 'range'")
-		writeContentRange(w, contents, rangeHeader, vbs)
+
+	if failOnHeader(w, req) {
 		return
 	}
 
-	// handle x-dolt-range header
-	xRangeHeader := req.Header.Get("X-Dolt-Range")
-	if xRangeHeader == "" {
-		xRangeHeader = req.Header.Get("x-dolt-range")
+	// repeated requests with the same Idempotency-Key are answered with the first one's response. Keys are
+	// checked after errors are injected, so injected errors are neither replayed nor cached.
+	if key := req.Header.Get("Idempotency-Key"); key != "" && *idempotencyTTL > 0 {
+		if replayIdempotent(w, key) {
+			return
+		}
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		defer rec.store(key)
+		w = rec
+	}
+
+	if latency != nil {
+		d := latency.sample(rng)
+		fmt.Fprintln(logOut, "injecting latency:", d)
+		if err := sleepContext(req.Context(), d); err != nil {
+			fmt.Fprintln(logOut, "request canceled during injected latency:", err.Error())
+			fmt.Fprintln(logOut)
+			return
+		}
+	}
+
+	if contents.precompressed != nil || len(contentEncodings) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+
+	// a precompressed companion of a --content-dir file is served as is to clients accepting gzip, and
+	// ranges select bytes of the compressed file
+	if contents.precompressed != nil && acceptsGzip(acceptEncoding(req)) {
+		fmt.Fprintln(logOut, "serving precompressed content-encoding:", gzipEncoding)
+		w.Header().Add("Content-Encoding", gzipEncoding)
+		contents = contents.precompressed
+	} else if len(contentEncodings) > 0 {
+		supported := contentEncodings
+		if !contents.encodable() {
+			fmt.Fprintln(logOut, "content too large to encode:", contents.Len())
+			supported = nil
+		}
+		enc, ok := negotiateEncoding(acceptEncoding(req), supported)
+		if !ok {
+			fmt.Fprintln(logOut, "no acceptable content encoding:", acceptEncoding(req))
+			fmt.Fprintln(logOut, "status-code:", http.StatusNotAcceptable)
+			fmt.Fprintln(logOut)
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		if enc != identityEncoding {
+			encoded, err := contents.encode(enc)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintln(logOut, "failed to encode content:", err.Error())
+				fmt.Fprintln(logOut)
+				return
+			}
+			fmt.Fprintln(logOut, "content-encoding:", enc)
+			w.Header().Add("Content-Encoding", enc)
+			contents = encoded
+		}
 	}
-	if xRangeHeader != "" {
-		fmt.Println("header: 'x-dolt-range'")
-		writeContentRange(w, contents, xRangeHeader, vbs)
+
+	etag := contents.ETag()
+	if *volatileETag {
+		etag = fmt.Sprintf(`"%016x"`, rng.Uint64())
+		fmt.Fprintln(logOut, "volatile etag:", etag)
+	}
+	// weak etags still match If-None-Match, but never If-Match or If-Range, which require strong comparison
+	if *weakETag {
+		etag = "W/" + etag
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", contents.modTime.Format(http.TimeFormat))
+	if !checkIfMatch(w, req, etag) || !checkIfNoneMatch(w, req, etag) {
 		return
 	}
 
-	// handle query params
-	rangeParam := req.URL.Query().Get("Range")
-	if rangeParam == "" {
-		rangeParam = req.URL.Query().Get("range")
+	if *tarpit {
+		serveTarpit(w, req, contents, *tarpitInterval)
+		return
 	}
-	if rangeParam != "" {
-		fmt.Println("query param: 'range'")
-		writeContentRange(w, contents, rangeParam, vbs)
+
+	// the seeded rng makes the surprising statuses reproducible
+	jitterStatus := *statusJitter > 0 && contents.Len() > 0 && rng.Float64() < *statusJitter
+
+	if src, rangeStr, ok := findRange(req); ok {
+		fmt.Fprintln(logOut, src.desc)
+		if jitterStatus {
+			fmt.Fprintln(logOut, "status jitter: ignoring range")
+		} else if ifRangeMatches(req, etag, contents.modTime) {
+			writeContentRange(w, contents, rangeStr, vbs)
+			return
+		} else {
+			fmt.Fprintln(logOut, "if-range did not match, ignoring range:", req.Header.Get("If-Range"))
+		}
+	} else if jitterStatus {
+		fmt.Fprintln(logOut, "status jitter: serving all content as a range")
+		writeContentRange(w, contents, "bytes=0-", vbs)
 		return
 	}
 
 	// if there's no range requests, getHttpServer all content
-	fmt.Println("for all content")
-	b := contents.ReadAll()
+	fmt.Fprintln(logOut, "for all content")
+	writeAllContent(w, contents)
+}
+
+// writeAllContent responds 200 with the full contents
+func writeAllContent(w http.ResponseWriter, contents *inMemContents) {
+	metrics.countOutcome(outcomeFull)
 
 	if *verbose {
-		fmt.Println("encoded content:", base64.StdEncoding.EncodeToString(b))
+		fmt.Fprintln(logOut, "encoded content:", base64.StdEncoding.EncodeToString(contents.ReadAll()))
 	}
 
-	fmt.Println("content-length:", contents.Len())
-	fmt.Println("status-code:", http.StatusOK)
-	fmt.Println()
+	fmt.Fprintln(logOut, "content-length:", contents.Len())
+	fmt.Fprintln(logOut, "status-code:", http.StatusOK)
+	fmt.Fprintln(logOut)
 
 	w.Header().Add("Content-Length", strconv.FormatInt(contents.Len(), 10))
 	w.WriteHeader(http.StatusOK)
 
-	n, err := w.Write(b)
+	n, err := contents.writeRange(0, contents.Len(), func(b []byte) (int, error) {
+		return writeBody(w, b)
+	})
 	if err != nil {
-		panic(err)
-	}
-	if int64(n) != contents.Len() {
-		panic("failed to write all contents")
+		fmt.Fprintf(logOut, "failed to write all contents: wrote %d of %d: %s\n", n, contents.Len(), err.Error())
+		fmt.Fprintln(logOut)
 	}
 }
 
 func writeContentRange(w http.ResponseWriter, contents *inMemContents, rangeStr string, vbs bool) {
+	if strings.Contains(rangeStr, ",") {
+		writeMultiRange(w, contents, rangeStr, vbs)
+		return
+	}
+
+	rangeStart := time.Now()
 	offset, length, err := offsetAndLenFromRange(rangeStr, int64(contents.Len()))
+	if errors.Is(err, errUnsatisfiableRange) {
+		fmt.Fprintln(logOut, "range not satisfiable:", err.Error())
+		metrics.countOutcome(outcomeUnsatisfiable)
+		writeRangeNotSatisfiable(w, contents.Len())
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("bad request:", err.Error())
-		fmt.Println()
+		fmt.Fprintln(logOut, "bad request:", err.Error())
+		fmt.Fprintln(logOut)
 		return
 	}
 
-	b, err := contents.ReadRange(offset, offset+length)
-	if err != nil {
+	if *rangeAlignment > 0 && length > 0 {
+		offset, length = alignRange(offset, length, *rangeAlignment, contents.Len())
+		fmt.Fprintln(logOut, "aligned range:", formatContentRange(offset, length, contents.Len()))
+	}
+
+	if !contents.validRange(offset, offset+length) {
 		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("bad request:", err.Error())
-		fmt.Println()
+		fmt.Fprintln(logOut, "bad request:", errInvalidRange.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	if availableRanges != nil && length > 0 {
+		var ok bool
+		offset, length, ok = availableOverlap(availableRanges, offset, length)
+		if !ok {
+			fmt.Fprintln(logOut, "requested range is not available")
+			metrics.countOutcome(outcomeUnsatisfiable)
+			writeRangeNotSatisfiable(w, contents.Len())
+			return
+		}
+	}
+
+	// a range spanning all content may be answered as a full response, see RFC 9110 section 14.2
+	if *prefer200OnFullRange && offset == 0 && length == contents.Len() {
+		fmt.Fprintln(logOut, "range spans all content")
+		writeAllContent(w, contents)
 		return
 	}
 
-	fmt.Println("responding:")
+	fmt.Fprintln(logOut, "responding:")
 
-	contentRange := fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, contents.Len())
+	// only a suffix range of zero bytes, ie `bytes=-0`, selects zero bytes, as ranges starting at or past
+	// the end of the content are unsatisfiable. It is answered with 204 No Content rather than an empty 206,
+	// since there is no valid Content-Range describing an empty range
+	if length == 0 {
+		metrics.countOutcome(outcomeEmpty)
+		fmt.Fprintln(logOut, "status-code:", http.StatusNoContent)
+		fmt.Fprintln(logOut)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	metrics.observeRange(length)
+	total := contents.Len()
+	if *fakeTotal > 0 {
+		fmt.Fprintln(logOut, "reporting fake total:", *fakeTotal)
+		total = *fakeTotal
+	}
+
+	contentRange := formatContentRange(offset, length, total)
 	contentLength := fmt.Sprintf("%d", length)
 	statusCode := http.StatusPartialContent
 
-	fmt.Println("content-range:", contentRange)
-	fmt.Println("content-length:", contentLength)
-	fmt.Println("status-code:", statusCode)
+	addServerTiming(w.Header(), "range", time.Since(rangeStart))
+
+	fmt.Fprintln(logOut, "content-range:", contentRange)
+	fmt.Fprintln(logOut, "content-length:", contentLength)
+	fmt.Fprintln(logOut, "status-code:", statusCode)
 
 	w.Header().Add("Content-Range", contentRange)
 	w.Header().Add("Content-Length", contentLength)
 	w.WriteHeader(statusCode)
 
 	if vbs {
-		fmt.Println("encoded range:", base64.StdEncoding.EncodeToString(b))
-		fmt.Println()
+		b, _ := contents.ReadRange(offset, offset+length)
+		fmt.Fprintln(logOut, "encoded range:", base64.StdEncoding.EncodeToString(b))
+		fmt.Fprintln(logOut)
 	}
 
-	fmt.Println()
+	fmt.Fprintln(logOut)
 
-	n, err := w.Write(b)
+	n, err := contents.writeRange(offset, offset+length, func(b []byte) (int, error) {
+		return writeBody(w, b)
+	})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Println("failed to write range:", err.Error())
-		fmt.Println()
+		fmt.Fprintf(logOut, "failed to write range: wrote %d of %d: %s\n", n, length, err.Error())
+		fmt.Fprintln(logOut)
 	}
+}
 
-	if int64(n) != length {
-		w.WriteHeader(http.StatusInternalServerError)
-		panic(fmt.Sprintf("failed to write partial contents: wrote %d of %d", n, length))
-	}
+func formatContentRange(offset, length, size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size)
 }
 
 func offsetAndLenFromRange(rngStr string, contentSize int64) (int64, int64, error) {
@@ -234,6 +845,7 @@ func offsetAndLenFromRange(rngStr string, contentSize int64) (int64, int64, erro
 		return -1, -1, nil
 	}
 
+	// header values are never url decoded, so a percent encoded `bytes%3D0-100` is rejected here
 	if !strings.HasPrefix(rngStr, "bytes=") {
 		return -1, -1, errInvalidRangeStr
 	}
@@ -249,6 +861,13 @@ func offsetAndLenFromRange(rngStr string, contentSize int64) (int64, int64, erro
 		if err != nil {
 			return -1, -1, errInvalidRangeStr
 		}
+		// a suffix longer than the content selects all of it when clamped, as RFC 9110 requires
+		if int64(length) > contentSize {
+			if *suffixOverflow == suffixOverflowReject {
+				return -1, -1, errUnsatisfiableRange
+			}
+			length = uint64(contentSize)
+		}
 		return contentSize - int64(length), int64(length), nil
 	}
 
@@ -258,6 +877,9 @@ func offsetAndLenFromRange(rngStr string, contentSize int64) (int64, int64, erro
 		if err != nil {
 			return -1, -1, err
 		}
+		if offset >= uint64(contentSize) {
+			return -1, -1, errUnsatisfiableRange
+		}
 		return int64(offset), int64(contentSize) - int64(offset), nil
 	}
 
@@ -271,66 +893,169 @@ func offsetAndLenFromRange(rngStr string, contentSize int64) (int64, int64, erro
 		return -1, -1, err
 	}
 
+	// a last position before the first is syntactically invalid, see RFC 9110 section 14.1.1
+	if end < start {
+		return -1, -1, errInvalidRange
+	}
+	// a range starting at or past the end of the content selects none of it
+	if start >= uint64(contentSize) {
+		return -1, -1, errUnsatisfiableRange
+	}
+
 	return int64(start), int64(end-start) + 1, nil
 }
 
 type inMemContents struct {
 	mu       *sync.Mutex
 	contents []byte
+	modTime  time.Time
+	etag     string
+
+	// precompressed is the gzip encoded companion of a --content-dir file, loaded from <name>.gz
+	precompressed *inMemContents
+
+	// encodings are the contents compressed with each content encoding requested so far, see encode
+	encodings map[string]*inMemContents
+
+	// generated contents are size bytes of pattern content produced from seed as they are read, rather than
+	// held in memory, see newGeneratedContents
+	generated bool
+	seed      int64
+	size      int64
 }
 
+// startTime is the last modified time of the built in content
+var startTime = time.Now().UTC().Truncate(time.Second)
+
 var text = `
 platea dictumst quisque sagittis purus sit amet volutpat consequat mauris nunc congue nisi vitae suscipit tellus mauris a diam maecenas sed enim ut sem viverra aliquet eget sit amet tellus cras adipiscing enim eu turpis egestas pretium aenean pharetra magna ac placerat vestibulum lectus mauris ultrices eros in cursus turpis massa tincidunt dui ut ornare lectus sit amet est placerat in egestas erat imperdiet sed euismod nisi porta lorem mollis aliquam ut porttitor leo a diam sollicitudin tempor id eu nisl nunc mi ipsum faucibus vitae aliquet nec ullamcorper sit amet risus nullam eget felis eget nunc lobortis mattis aliquam faucibus purus in massa tempor nec feugiat nisl pretium fusce id velit ut tortor pretium viverra suspendisse potenti nullam ac tortor vitae purus faucibus ornare suspendisse sed nisi lacus sed viverra tellus in hac habitasse platea dictumst vestibulum rhoncus est pellentesque elit ullamcorper dignissim cras tincidunt lobortis feugiat vivamus at augue eget arcu dictum varius duis at consectetur lorem donec massa sapien faucibus et molestie ac feugiat sed lectus vestibulum mattis ullamcorper velit sed ullamcorper morbi tincidunt ornare massa eget egestas purus viverra accumsan in nisl nisi scelerisque eu ultrices vitae auctor eu augue ut lectus arcu bibendum at varius vel pharetra vel turpis nunc eget lorem dolor sed viverra ipsum nunc aliquet bibendum enim facilisis gravida neque convallis a cras semper auctor neque vitae tempus quam pellentesque nec nam aliquam sem et tortor consequat id porta nibh venenatis cras sed felis eget velit aliquet sagittis id consectetur purus ut faucibus pulvinar elementum integer enim neque volutpat ac tincidunt vitae semper quis lectus nulla at volutpat diam ut venenatis tellus in metus vulputate eu scelerisque felis imperdiet proi fermentum leo vel orci porta non pulvinar neque laoreet suspendisse interdum consectetur libero id faucibus nisl tincidunt eget nullam non nisi est sit amet facilisis magna etiam tempor orci eu lobortis elementum nibh tellus molestie nunc non blandit massa enim nec dui nunc mattis enim ut tellus elementum sagittis vitae et leo duis ut diam quam nulla porttitor massa id neque aliquam vestibulum morbi blandit cursus risus at ultrices mi tempus imperdiet nulla malesuada pellentesque elit eget gravida cum sociis natoque penatibus et magnis dis parturient montes nascetur ridiculus mus mauris vitae ultricies leo integer malesuada nunc vel risus commodo viverra maecenas accumsan lacus vel facilisis volutpat est velit egestas dui id ornare arcu odio ut sem nulla pharetra diam sit amet nisl suscipit adipiscing bibendum est ultricies integer quis auctor elit sed vulputate mi sit amet mauris commodo quis imperdiet massa tincidunt nunc pulvinar sapien et ligula ullamcorper malesuada proin libero nunc consequat interdum varius sit amet mattis vulputate enim nulla aliquet porttitor lacus luctus accumsan tortor posuere ac ut consequat semper viverra nam libero justo laoreet sit amet cursus sit amet dictum sit amet justo donec enim diam vulputate ut pharetra sit amet aliquam id diam maecenas ultricies mi eget mauris pharetra et ultrices neque ornare aenean euismod elementum nisi quis eleifend quam adipiscing vitae proin sagittis nisl rhoncus mattis rhoncus urna neque viverra justo nec ultrices dui sapien eget mi proin sed libero enim sed faucibus turpis in eu mi bibendum neque egestas congue quisque egestas diam in arcu cursus euismod quis viverra nibh cras pulvinar mattis nunc sed blandit libero volutpat sed cras ornare arcu dui vivamus arcu felis bibendum ut tristique et egestas quis ipsum suspendisse ultrices gravida dictum fusce ut placerat orci nulla pellentesque dignissim enim sit amet venenatis urna cursus eget nunc scelerisque viverra mauris in aliquam sem fringilla ut morbi tincidunt augue interdum velit euismod in pellentesque massa placerat duis ultricies lacus sed turpis tincidunt id aliquet risus feugiat in ante metus dictum at tempor commodo ullamcorp
 `
 
+// patternContent is the --pattern-size content, served in place of the built in text when set
+var patternContent []byte
+
+// builtInContents is the content served at / without a --content-dir. It is shared by requests so its
+// etag and encodings are computed once rather than per request.
+var builtInContents *inMemContents
+
 func newContents() *inMemContents {
+	contents := []byte(text)
+	if patternContent != nil {
+		contents = patternContent
+	}
 	return &inMemContents{
 		mu:       &sync.Mutex{},
-		contents: []byte(text),
+		contents: contents,
+		modTime:  startTime,
 	}
 }
 
 func (c *inMemContents) Len() int64 {
+	if c.generated {
+		return c.size
+	}
 	return int64(len(c.contents))
 }
 
+// ReadAll returns all of the contents. Generated contents are produced whole, so writeRange is preferred
+// for writing them.
 func (c *inMemContents) ReadAll() []byte {
+	if c.generated {
+		b, _ := c.ReadRange(0, c.size)
+		return b
+	}
 	return c.contents[:]
 }
 
 func (c *inMemContents) ReadRange(start, end int64) ([]byte, error) {
-	if end < start || end > c.Len() || start < 0 {
+	if !c.validRange(start, end) {
 		return nil, errInvalidRange
 	}
+	if c.generated {
+		b := make([]byte, end-start)
+		pattern.Fill(c.seed, b, start)
+		return b, nil
+	}
 	return c.contents[start:end], nil
 }
 
-func getHttpServer(port int, vbs bool) *http.Server {
+func (c *inMemContents) validRange(start, end int64) bool {
+	return start >= 0 && start <= end && end <= c.Len()
+}
+
+// generatedBlockSize is the number of bytes of generated contents produced at a time by writeRange
+const generatedBlockSize = 1 << 20
+
+// writeRange writes the bytes from start to end with write, in one call for contents held in memory and a
+// block at a time for generated contents, so only a block of them is ever held in memory. Returns the
+// number of bytes written.
+func (c *inMemContents) writeRange(start, end int64, write func(b []byte) (int, error)) (int64, error) {
+	if !c.generated {
+		b, err := c.ReadRange(start, end)
+		if err != nil {
+			return 0, err
+		}
+		n, err := write(b)
+		return int64(n), err
+	}
+
+	if !c.validRange(start, end) {
+		return 0, errInvalidRange
+	}
+
+	blockSize := end - start
+	if blockSize > generatedBlockSize {
+		blockSize = generatedBlockSize
+	}
+	buf := make([]byte, blockSize)
+
+	var written int64
+	for written < end-start {
+		b := buf
+		if remaining := end - start - written; remaining < int64(len(b)) {
+			b = b[:remaining]
+		}
+		pattern.Fill(c.seed, b, start+written)
+
+		n, err := write(b)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// getHttpServer builds the plain http server. Without ranges, its content is served whole to every request
+// and advertised with `Accept-Ranges: none`.
+func getHttpServer(port int, vbs bool, ranges bool) *http.Server {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
-		serveContents(writer, request, newContents(), vbs)
-	})
+	registerRoutes(mux, serverRoutes(vbs), nil)
+
+	handler := withStatusCounts(withDateHeader(withServerOptions(mux)))
+	if !ranges {
+		handler = withoutRanges(handler)
+	}
 
 	// support http2
 	h2s := &http2.Server{}
 
 	return &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: h2c.NewHandler(mux, h2s),
+		Addr:                         fmt.Sprintf(":%d", port),
+		Handler:                      h2c.NewHandler(handler, h2s),
+		DisableGeneralOptionsHandler: true,
 	}
 }
 
 func getHttpsServer(port int, vbs bool) (*http.Server, error) {
 	mux := http.NewServeMux()
-
-	mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
-		writer.Header().Add("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
-		serveContents(writer, request, newContents(), vbs)
+	registerRoutes(mux, serverRoutes(vbs), http.Header{
+		"Strict-Transport-Security": {"max-age=63072000; includeSubDomains"},
 	})
 
 	cfg := &tls.Config{
 		MinVersion:       tls.VersionTLS12,
-		CurvePreferences: []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
+		CurvePreferences: curvePreferences,
 		CipherSuites: []uint16{
 			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
@@ -341,11 +1066,32 @@ func getHttpsServer(port int, vbs bool) (*http.Server, error) {
 		},
 	}
 
+	// cipher suites aren't configurable in TLS 1.3, so the list only applies to older versions
+	if *tls13Only {
+		cfg.MinVersion = tls.VersionTLS13
+		cfg.MaxVersion = tls.VersionTLS13
+		cfg.CipherSuites = nil
+	}
+
+	if vbs {
+		// the full alpn offer is only visible during the handshake
+		cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			fmt.Fprintln(logOut, "alpn offered protocols:", hello.SupportedProtos, "from", hello.Conn.RemoteAddr())
+			return nil, nil
+		}
+	}
+
+	handler := withStatusCounts(withDateHeader(withServerOptions(mux)))
+	if *exposeTLSInfo {
+		handler = withTLSInfo(handler)
+	}
+
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
-		Handler:      mux,
-		TLSConfig:    cfg,
-		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
+		Addr:                         fmt.Sprintf(":%d", port),
+		Handler:                      handler,
+		TLSConfig:                    cfg,
+		TLSNextProto:                 make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
+		DisableGeneralOptionsHandler: true,
 	}
 
 	err := http2.ConfigureServer(srv, &http2.Server{})
@@ -353,5 +1099,30 @@ func getHttpsServer(port int, vbs bool) (*http.Server, error) {
 		return nil, err
 	}
 
+	// ConfigureServer adds h2 and http/1.1 to NextProtos, so an explicit list replaces them afterward.
+	// net/http re-adds h2 while it has an h2 handler, so that is removed when h2 is left out of the list.
+	if *alpnProtocols != "" {
+		var protos []string
+		for _, proto := range strings.Split(*alpnProtocols, ",") {
+			if proto = strings.TrimSpace(proto); proto != "" {
+				protos = append(protos, proto)
+			}
+		}
+		cfg.NextProtos = protos
+
+		if !containsString(protos, http2.NextProtoTLS) {
+			delete(srv.TLSNextProto, http2.NextProtoTLS)
+		}
+	}
+
 	return srv, nil
 }
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// builtInSize is the size of the built in content
+const builtInSize = 4000
+
+func TestMain(m *testing.M) {
+	logOut = io.Discard
+	rng = newLockedRand(1)
+
+	var err error
+	rangePrecedence, err = parseRangePrecedence(defaultRangePrecedence)
+	if err != nil {
+		panic(err)
+	}
+	builtInContents = newContents()
+	sizedContents = newSizedContents()
+
+	os.Exit(m.Run())
+}
+
+// setFlag sets a flag's value for the duration of a test
+func setFlag[T any](t testing.TB, flag *T, value T) {
+	old := *flag
+	*flag = value
+	t.Cleanup(func() {
+		*flag = old
+	})
+}
+
+// serveRequest serves a GET of the built in content, sent with header, through serveContents
+func serveRequest(t *testing.T, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	w := httptest.NewRecorder()
+	serveContents(w, req, newContents(), false)
+	return w
+}
+
+func TestOffsetAndLenFromRange(t *testing.T) {
+	tests := []struct {
+		rangeStr string
+		offset   int64
+		length   int64
+		err      error
+	}{
+		{rangeStr: "bytes=0-99", offset: 0, length: 100},
+		{rangeStr: "bytes=5-5", offset: 5, length: 1},
+		{rangeStr: "bytes=3999-3999", offset: 3999, length: 1},
+		{rangeStr: "bytes=3999-", offset: 3999, length: 1},
+		{rangeStr: "bytes=-80", offset: 3920, length: 80},
+		{rangeStr: "bytes=-0", offset: builtInSize, length: 0},
+		{rangeStr: "bytes=4000-", err: errUnsatisfiableRange},
+		{rangeStr: "bytes=4000-4001", err: errUnsatisfiableRange},
+		{rangeStr: "bytes=5-4", err: errInvalidRange},
+		{rangeStr: "bytes=5-1", err: errInvalidRange},
+		{rangeStr: "items=0-10", err: errInvalidRangeStr},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rangeStr, func(t *testing.T) {
+			offset, length, err := offsetAndLenFromRange(test.rangeStr, builtInSize)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected error %v, got: %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if offset != test.offset || length != test.length {
+				t.Errorf("expected offset %d length %d, got offset %d length %d", test.offset, test.length, offset, length)
+			}
+		})
+	}
+}
+
+func TestZeroLengthRanges(t *testing.T) {
+	tests := []struct {
+		rangeStr     string
+		status       int
+		contentRange string
+		bodyLen      int
+	}{
+		{rangeStr: "bytes=-0", status: http.StatusNoContent},
+		{rangeStr: "bytes=0-0", status: http.StatusPartialContent, contentRange: "bytes 0-0/4000", bodyLen: 1},
+		{rangeStr: "bytes=5-5", status: http.StatusPartialContent, contentRange: "bytes 5-5/4000", bodyLen: 1},
+		{rangeStr: "bytes=3999-3999", status: http.StatusPartialContent, contentRange: "bytes 3999-3999/4000", bodyLen: 1},
+		{rangeStr: "bytes=4000-", status: http.StatusRequestedRangeNotSatisfiable, contentRange: "bytes */4000"},
+		{rangeStr: "bytes=5-4", status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rangeStr, func(t *testing.T) {
+			w := serveRequest(t, http.Header{"Range": {test.rangeStr}})
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, w.Code)
+			}
+			if contentRange := w.Header().Get("Content-Range"); contentRange != test.contentRange {
+				t.Errorf("expected content-range '%s', got: '%s'", test.contentRange, contentRange)
+			}
+			if w.Body.Len() != test.bodyLen {
+				t.Errorf("expected a %d byte body, got: %d", test.bodyLen, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestSuffixOverflow(t *testing.T) {
+	tests := []struct {
+		mode         string
+		rangeStr     string
+		status       int
+		contentRange string
+		bodyLen      int
+	}{
+		{mode: suffixOverflowClamp, rangeStr: "bytes=-5000", status: http.StatusPartialContent, contentRange: "bytes 0-3999/4000", bodyLen: builtInSize},
+		{mode: suffixOverflowClamp, rangeStr: "bytes=-4000", status: http.StatusPartialContent, contentRange: "bytes 0-3999/4000", bodyLen: builtInSize},
+		{mode: suffixOverflowClamp, rangeStr: "bytes=-80", status: http.StatusPartialContent, contentRange: "bytes 3920-3999/4000", bodyLen: 80},
+		{mode: suffixOverflowReject, rangeStr: "bytes=-5000", status: http.StatusRequestedRangeNotSatisfiable, contentRange: "bytes */4000"},
+		{mode: suffixOverflowReject, rangeStr: "bytes=-4000", status: http.StatusPartialContent, contentRange: "bytes 0-3999/4000", bodyLen: builtInSize},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode+" "+test.rangeStr, func(t *testing.T) {
+			setFlag(t, suffixOverflow, test.mode)
+
+			w := serveRequest(t, http.Header{"Range": {test.rangeStr}})
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, w.Code)
+			}
+			if contentRange := w.Header().Get("Content-Range"); contentRange != test.contentRange {
+				t.Errorf("expected content-range '%s', got: '%s'", test.contentRange, contentRange)
+			}
+			if w.Body.Len() != test.bodyLen {
+				t.Errorf("expected a %d byte body, got: %d", test.bodyLen, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestFullRangeModes(t *testing.T) {
+	tests := []struct {
+		name         string
+		always206    bool
+		prefer200    bool
+		rangeStr     string
+		status       int
+		contentRange string
+	}{
+		{name: "default", rangeStr: "bytes=0-", status: http.StatusPartialContent, contentRange: "bytes 0-3999/4000"},
+		{name: "always 206", always206: true, rangeStr: "bytes=0-", status: http.StatusPartialContent, contentRange: "bytes 0-3999/4000"},
+		{name: "always 206 explicit end", always206: true, rangeStr: "bytes=0-3999", status: http.StatusPartialContent, contentRange: "bytes 0-3999/4000"},
+		{name: "always 206 suffix", always206: true, rangeStr: "bytes=-4000", status: http.StatusPartialContent, contentRange: "bytes 0-3999/4000"},
+		{name: "prefer 200", prefer200: true, rangeStr: "bytes=0-", status: http.StatusOK},
+		{name: "prefer 200 explicit end", prefer200: true, rangeStr: "bytes=0-3999", status: http.StatusOK},
+		{name: "prefer 200 suffix", prefer200: true, rangeStr: "bytes=-4000", status: http.StatusOK},
+		{name: "prefer 200 partial range", prefer200: true, rangeStr: "bytes=1-", status: http.StatusPartialContent, contentRange: "bytes 1-3999/4000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setFlag(t, always206OnRange, test.always206)
+			setFlag(t, prefer200OnFullRange, test.prefer200)
+
+			w := serveRequest(t, http.Header{"Range": {test.rangeStr}})
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, w.Code)
+			}
+			if contentRange := w.Header().Get("Content-Range"); contentRange != test.contentRange {
+				t.Errorf("expected content-range '%s', got: '%s'", test.contentRange, contentRange)
+			}
+		})
+	}
+}
+
+func TestFullRangeModesConflict(t *testing.T) {
+	setFlag(t, certFile, "cert.pem")
+	setFlag(t, keyFile, "key.pem")
+	setFlag(t, always206OnRange, true)
+	setFlag(t, prefer200OnFullRange, true)
+
+	err := configure()
+	if err == nil || !strings.Contains(err.Error(), "--always-206-on-range can't be used with --prefer-200-on-full-range") {
+		t.Fatalf("expected the modes to conflict, got: %v", err)
+	}
+}
+
+func TestPercentEncodedRangeRejected(t *testing.T) {
+	for _, header := range []string{"Range", "X-Dolt-Range"} {
+		for _, rangeStr := range []string{"bytes%3D0-100", "bytes%3d0-100", "bytes%3D0-9%2C20-29"} {
+			t.Run(header+" "+rangeStr, func(t *testing.T) {
+				w := serveRequest(t, http.Header{header: {rangeStr}})
+				if w.Code != http.StatusBadRequest {
+					t.Fatalf("expected status %d, got: %d", http.StatusBadRequest, w.Code)
+				}
+				if w.Body.Len() != 0 {
+					t.Errorf("expected no content served, got %d bytes", w.Body.Len())
+				}
+			})
+		}
+	}
+}
+
+func TestDoltRangeSuffix(t *testing.T) {
+	tests := []struct {
+		rangeStr     string
+		status       int
+		contentRange string
+		body         string
+	}{
+		{rangeStr: "-80", status: http.StatusPartialContent, contentRange: "bytes 3920-3999/4000", body: text[3920:]},
+		{rangeStr: "bytes=-80", status: http.StatusPartialContent, contentRange: "bytes 3920-3999/4000", body: text[3920:]},
+		{rangeStr: "-1", status: http.StatusPartialContent, contentRange: "bytes 3999-3999/4000", body: text[3999:]},
+		{rangeStr: "-4000", status: http.StatusPartialContent, contentRange: "bytes 0-3999/4000", body: text},
+		{rangeStr: "-5000", status: http.StatusPartialContent, contentRange: "bytes 0-3999/4000", body: text},
+		{rangeStr: "-0", status: http.StatusNoContent},
+		{rangeStr: "-x", status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rangeStr, func(t *testing.T) {
+			w := serveRequest(t, http.Header{"X-Dolt-Range": {test.rangeStr}})
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, w.Code)
+			}
+			if contentRange := w.Header().Get("Content-Range"); contentRange != test.contentRange {
+				t.Errorf("expected content-range '%s', got: '%s'", test.contentRange, contentRange)
+			}
+			if w.Body.String() != test.body {
+				t.Errorf("expected %d bytes from the end of the content, got %d bytes", len(test.body), w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestDoltRangeSuffixRejected(t *testing.T) {
+	setFlag(t, suffixOverflow, suffixOverflowReject)
+
+	w := serveRequest(t, http.Header{"X-Dolt-Range": {"-5000"}})
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("expected status %d, got: %d", http.StatusRequestedRangeNotSatisfiable, w.Code)
+	}
+	if contentRange := w.Header().Get("Content-Range"); contentRange != "bytes */4000" {
+		t.Errorf("expected content-range 'bytes */4000', got: '%s'", contentRange)
+	}
+}
+
+func TestUnsatisfiableRangeContentRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+	}{
+		{name: "start at end", target: "/", header: http.Header{"Range": {"bytes=4000-4001"}}},
+		{name: "open start at end", target: "/", header: http.Header{"Range": {"bytes=4000-"}}},
+		{name: "start past end", target: "/", header: http.Header{"Range": {"bytes=9999-10000"}}},
+		{name: "dolt header", target: "/", header: http.Header{"X-Dolt-Range": {"bytes=4000-4001"}}},
+		{name: "query param", target: "/?range=bytes%3D4000-4001"},
+		{name: "multiple ranges", target: "/", header: http.Header{"Range": {"bytes=4000-4001,5000-"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.target, nil)
+			for name, values := range test.header {
+				req.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+			serveContents(w, req, newContents(), false)
+
+			if w.Code != http.StatusRequestedRangeNotSatisfiable {
+				t.Fatalf("expected status %d, got: %d", http.StatusRequestedRangeNotSatisfiable, w.Code)
+			}
+			if contentRange := w.Header().Get("Content-Range"); contentRange != "bytes */4000" {
+				t.Errorf("expected content-range 'bytes */4000', got: '%s'", contentRange)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	outcomeFull          = "full"
+	outcomePartial       = "partial"
+	outcomeEmpty         = "empty"
+	outcomeUnsatisfiable = "unsatisfiable"
+)
+
+// rangeSizeBuckets are the upper bounds, in bytes, of the range size histogram buckets
+var rangeSizeBuckets = []int64{0, 10, 100, 1000, 10000, 100000, 1000000, 10000000}
+
+// contentMetrics counts content requests by outcome and records a histogram of the sizes of served ranges
+type contentMetrics struct {
+	mu           *sync.Mutex
+	outcomes     map[string]int64
+	bucketCounts []int64
+	rangeSum     int64
+	rangeCount   int64
+}
+
+var metrics = &contentMetrics{
+	mu:           &sync.Mutex{},
+	outcomes:     map[string]int64{outcomeFull: 0, outcomePartial: 0, outcomeEmpty: 0, outcomeUnsatisfiable: 0},
+	bucketCounts: make([]int64, len(rangeSizeBuckets)),
+}
+
+func (m *contentMetrics) countOutcome(outcome string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outcomes[outcome]++
+}
+
+// observeRange counts a partial response and records the length of its range
+func (m *contentMetrics) observeRange(length int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.outcomes[outcomePartial]++
+	m.rangeSum += length
+	m.rangeCount++
+	for i, bound := range rangeSizeBuckets {
+		if length <= bound {
+			m.bucketCounts[i]++
+		}
+	}
+}
+
+// writeTo writes the metrics in the prometheus text exposition format
+func (m *contentMetrics) writeTo(buf *bytes.Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buf.WriteString("# HELP headers_tester_content_requests_total Content requests by outcome.\n")
+	buf.WriteString("# TYPE headers_tester_content_requests_total counter\n")
+	for _, outcome := range []string{outcomeFull, outcomePartial, outcomeEmpty, outcomeUnsatisfiable} {
+		fmt.Fprintf(buf, "headers_tester_content_requests_total{outcome=%q} %d\n", outcome, m.outcomes[outcome])
+	}
+
+	buf.WriteString("# HELP headers_tester_range_size_bytes Sizes of the ranges served.\n")
+	buf.WriteString("# TYPE headers_tester_range_size_bytes histogram\n")
+	for i, bound := range rangeSizeBuckets {
+		fmt.Fprintf(buf, "headers_tester_range_size_bytes_bucket{le=%q} %d\n", strconv.FormatInt(bound, 10), m.bucketCounts[i])
+	}
+	fmt.Fprintf(buf, "headers_tester_range_size_bytes_bucket{le=\"+Inf\"} %d\n", m.rangeCount)
+	fmt.Fprintf(buf, "headers_tester_range_size_bytes_sum %d\n", m.rangeSum)
+	fmt.Fprintf(buf, "headers_tester_range_size_bytes_count %d\n", m.rangeCount)
+}
+
+// serveMetrics responds with the content metrics for scraping by prometheus
+func serveMetrics(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(logOut, "received metrics request")
+
+	var buf bytes.Buffer
+	metrics.writeTo(&buf)
+	writeInflightMetrics(&buf)
+
+	w.Header().Add("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Add("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		fmt.Fprintln(logOut, "failed to write metrics:", err.Error())
+	}
+	fmt.Fprintln(logOut)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMetricsZeroLengthRange(t *testing.T) {
+	outcome := func(name string) int64 {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return metrics.outcomes[name]
+	}
+	rangeCount := func() int64 {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return metrics.rangeCount
+	}
+
+	empty, partial, ranges := outcome(outcomeEmpty), outcome(outcomePartial), rangeCount()
+
+	if w := serveRequest(t, http.Header{"Range": {"bytes=-0"}}); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got: %d", http.StatusNoContent, w.Code)
+	}
+	if n := outcome(outcomeEmpty) - empty; n != 1 {
+		t.Errorf("expected 1 empty outcome counted, got: %d", n)
+	}
+	if n := outcome(outcomePartial) - partial; n != 0 {
+		t.Errorf("expected no partial outcome counted, got: %d", n)
+	}
+	if n := rangeCount() - ranges; n != 0 {
+		t.Errorf("expected no range size observed, got: %d", n)
+	}
+
+	if w := serveRequest(t, http.Header{"Range": {"bytes=0-0"}}); w.Code != http.StatusPartialContent {
+		t.Fatalf("expected status %d, got: %d", http.StatusPartialContent, w.Code)
+	}
+	if n := outcome(outcomePartial) - partial; n != 1 {
+		t.Errorf("expected 1 partial outcome counted, got: %d", n)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errTooManyRangeSegments = errors.New("too many range segments")
+var errExcessiveRanges = errors.New("ranges hold too many bytes")
+
+// maxRangeOverlap is the most times the content's size that the ranges of a multi-range request may add up to
+const maxRangeOverlap = 2
+
+// byteRange is a satisfiable range of content
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+// coalesce merges overlapping and adjacent ranges, ie `0-100,101-200` into `0-200`, returning the merged
+// ranges in order of offset
+func coalesce(ranges []byteRange) []byteRange {
+	sorted := append([]byteRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].offset < sorted[j].offset
+	})
+
+	merged := []byteRange{sorted[0]}
+	for _, rng := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if rng.offset > last.offset+last.length {
+			merged = append(merged, rng)
+			continue
+		}
+		if end := rng.offset + rng.length; end > last.offset+last.length {
+			last.length = end - last.offset
+		}
+	}
+	return merged
+}
+
+// writeMultiRange responds to a Range header listing several ranges, ie `bytes=0-9,20-29`, with a
+// multipart/byteranges body containing one part per satisfiable range, in the order requested. With
+// --coalesce-ranges, overlapping and adjacent ranges are merged first, and ranges that merge into one are
+// answered as a single range.
+func writeMultiRange(w http.ResponseWriter, contents *inMemContents, rangeStr string, vbs bool) {
+	if !strings.HasPrefix(rangeStr, "bytes=") {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(logOut, "bad request:", errInvalidRangeStr.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	// segments are counted before anything is parsed, so an oversized header is rejected without
+	// allocating for each of its segments
+	segmentCount := strings.Count(rangeStr, ",") + 1
+	if *maxRangeSegments > 0 && segmentCount > *maxRangeSegments {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(logOut, "bad request:", errTooManyRangeSegments.Error(), segmentCount, "of", *maxRangeSegments)
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	rangeStart := time.Now()
+
+	var segments []byteRange
+	for _, segment := range strings.Split(rangeStr[6:], ",") {
+		offset, length, err := offsetAndLenFromRange("bytes="+strings.TrimSpace(segment), contents.Len())
+		if errors.Is(err, errUnsatisfiableRange) || (err == nil && (length <= 0 || offset >= contents.Len())) {
+			fmt.Fprintln(logOut, "skipping unsatisfiable range:", segment)
+			continue
+		}
+		if err == nil && offset+length > contents.Len() {
+			err = errInvalidRange
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(logOut, "bad request:", err.Error())
+			fmt.Fprintln(logOut)
+			return
+		}
+		segments = append(segments, byteRange{offset: offset, length: length})
+	}
+
+	if len(segments) == 0 {
+		fmt.Fprintln(logOut, "range not satisfiable: no satisfiable range segments")
+		metrics.countOutcome(outcomeUnsatisfiable)
+		writeRangeNotSatisfiable(w, contents.Len())
+		return
+	}
+
+	if *coalesceRanges {
+		segments = coalesce(segments)
+		fmt.Fprintln(logOut, "coalesced ranges:", len(segments))
+		if len(segments) == 1 {
+			seg := segments[0]
+			writeContentRange(w, contents, fmt.Sprintf("bytes=%d-%d", seg.offset, seg.offset+seg.length-1), vbs)
+			return
+		}
+	}
+
+	// overlapping ranges could otherwise ask for many copies of the content, ie `bytes=0-,0-,0-`, see RFC 9110
+	// section 14.2. Twice the content still allows some overlap, like both parts of the `bytes=0-0,-1` probe
+	// of a one byte object.
+	var total int64
+	for _, seg := range segments {
+		total += seg.length
+	}
+	if total > maxRangeOverlap*contents.Len() {
+		fmt.Fprintln(logOut, "range not satisfiable:", errExcessiveRanges.Error(), total, "of", contents.Len())
+		metrics.countOutcome(outcomeUnsatisfiable)
+		writeRangeNotSatisfiable(w, contents.Len())
+		return
+	}
+
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	contentLength, err := multipartLength(contents, segments, boundary)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(logOut, "failed to size ranges:", err.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	metrics.observeRange(total)
+	statusCode := http.StatusPartialContent
+
+	addServerTiming(w.Header(), "range", time.Since(rangeStart))
+
+	fmt.Fprintln(logOut, "responding:")
+	for _, seg := range segments {
+		fmt.Fprintln(logOut, "part content-range:", formatContentRange(seg.offset, seg.length, contents.Len()))
+		if vbs {
+			b, _ := contents.ReadRange(seg.offset, seg.offset+seg.length)
+			fmt.Fprintln(logOut, "encoded part:", base64.StdEncoding.EncodeToString(b))
+		}
+	}
+	fmt.Fprintln(logOut, "parts:", len(segments))
+	fmt.Fprintln(logOut, "content-length:", contentLength)
+	fmt.Fprintln(logOut, "status-code:", statusCode)
+	fmt.Fprintln(logOut)
+
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	w.Header().Add("Content-Length", strconv.FormatInt(contentLength, 10))
+	w.WriteHeader(statusCode)
+
+	// parts are written straight to the response as they're read, so only a block of the content is held in
+	// memory at a time however large the ranges are
+	body := &countingBodyWriter{w: w}
+	if err = writeParts(multipart.NewWriter(body), contents, segments, boundary); err != nil {
+		fmt.Fprintf(logOut, "failed to write ranges: wrote %d of %d: %s\n", body.written, contentLength, err.Error())
+		fmt.Fprintln(logOut)
+	}
+}
+
+// writeParts writes a multipart/byteranges body with a part for each segment of contents to mw
+func writeParts(mw *multipart.Writer, contents *inMemContents, segments []byteRange, boundary string) error {
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for _, seg := range segments {
+		part, err := mw.CreatePart(partHeader(formatContentRange(seg.offset, seg.length, contents.Len())))
+		if err != nil {
+			return err
+		}
+		if _, err = contents.writeRange(seg.offset, seg.offset+seg.length, part.Write); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// multipartLength returns the length of the multipart/byteranges body writeParts writes, by writing the part
+// headers and boundaries while only counting the bytes of the parts
+func multipartLength(contents *inMemContents, segments []byteRange, boundary string) (int64, error) {
+	counter := &countingBodyWriter{}
+	mw := multipart.NewWriter(counter)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return 0, err
+	}
+
+	for _, seg := range segments {
+		if _, err := mw.CreatePart(partHeader(formatContentRange(seg.offset, seg.length, contents.Len()))); err != nil {
+			return 0, err
+		}
+		counter.written += seg.length
+	}
+	if err := mw.Close(); err != nil {
+		return 0, err
+	}
+	return counter.written, nil
+}
+
+// countingBodyWriter writes response body bytes to w with writeBody, counting them. Without w, bytes are
+// only counted.
+type countingBodyWriter struct {
+	w       http.ResponseWriter
+	written int64
+}
+
+func (c *countingBodyWriter) Write(b []byte) (int, error) {
+	if c.w == nil {
+		c.written += int64(len(b))
+		return len(b), nil
+	}
+	n, err := writeBody(c.w, b)
+	c.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dolthub/headers_tester/pattern"
+)
+
+// multipartRanges returns the Content-Range of each part of a multipart/byteranges response, checking each
+// part holds the bytes of the built in content its Content-Range describes
+func multipartRanges(t *testing.T, w *httptest.ResponseRecorder) []string {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("expected a multipart/byteranges response, got content-type: '%s'", w.Header().Get("Content-Type"))
+	}
+
+	if contentLength := w.Header().Get("Content-Length"); contentLength != strconv.Itoa(w.Body.Len()) {
+		t.Errorf("expected content-length of the %d byte body, got: '%s'", w.Body.Len(), contentLength)
+	}
+
+	var ranges []string
+	mr := multipart.NewReader(bytes.NewReader(w.Body.Bytes()), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return ranges
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contentRange := part.Header.Get("Content-Range")
+		var first, last, size int64
+		if _, err = fmt.Sscanf(contentRange, "bytes %d-%d/%d", &first, &last, &size); err != nil {
+			t.Fatalf("part has an invalid content-range: '%s'", contentRange)
+		}
+		if string(b) != text[first:last+1] {
+			t.Errorf("part %s does not hold the content it describes", contentRange)
+		}
+		ranges = append(ranges, contentRange)
+	}
+}
+
+// segmentedRange returns a Range header listing count one byte ranges, every other byte from the start
+func segmentedRange(count int) string {
+	segments := make([]string, count)
+	for i := range segments {
+		segments[i] = fmt.Sprintf("%d-%d", i*2, i*2)
+	}
+	return "bytes=" + strings.Join(segments, ",")
+}
+
+func TestMaxRangeSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      int
+		segments int
+		status   int
+	}{
+		{name: "100 of default 128", max: 128, segments: 100, status: http.StatusPartialContent},
+		{name: "128 of default 128", max: 128, segments: 128, status: http.StatusPartialContent},
+		{name: "129 of default 128", max: 128, segments: 129, status: http.StatusBadRequest},
+		{name: "1000 of default 128", max: 128, segments: 1000, status: http.StatusBadRequest},
+		{name: "101 of 100", max: 100, segments: 101, status: http.StatusBadRequest},
+		{name: "1000 unlimited", max: 0, segments: 1000, status: http.StatusPartialContent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setFlag(t, maxRangeSegments, test.max)
+
+			w := serveRequest(t, http.Header{"Range": {segmentedRange(test.segments)}})
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, w.Code)
+			}
+			if test.status != http.StatusPartialContent {
+				return
+			}
+
+			ranges := multipartRanges(t, w)
+			if len(ranges) != test.segments {
+				t.Fatalf("expected %d parts, got: %d", test.segments, len(ranges))
+			}
+			if last := fmt.Sprintf("bytes %d-%d/4000", (test.segments-1)*2, (test.segments-1)*2); ranges[len(ranges)-1] != last {
+				t.Errorf("expected the last part to be '%s', got: '%s'", last, ranges[len(ranges)-1])
+			}
+		})
+	}
+}
+
+func TestCoalesceRanges(t *testing.T) {
+	tests := []struct {
+		name         string
+		rangeStr     string
+		contentRange string
+		parts        []string
+	}{
+		{name: "adjacent", rangeStr: "bytes=0-100,101-200", contentRange: "bytes 0-200/4000"},
+		{name: "overlapping", rangeStr: "bytes=0-150,100-200", contentRange: "bytes 0-200/4000"},
+		{name: "contained", rangeStr: "bytes=0-200,50-60", contentRange: "bytes 0-200/4000"},
+		{name: "out of order", rangeStr: "bytes=101-200,0-100", contentRange: "bytes 0-200/4000"},
+		{name: "suffix overlapping", rangeStr: "bytes=3900-3950,-80", contentRange: "bytes 3900-3999/4000"},
+		{name: "disjoint", rangeStr: "bytes=0-100,102-200", parts: []string{"bytes 0-100/4000", "bytes 102-200/4000"}},
+		{name: "disjoint out of order", rangeStr: "bytes=300-399,0-99,50-149", parts: []string{"bytes 0-149/4000", "bytes 300-399/4000"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setFlag(t, coalesceRanges, true)
+
+			w := serveRequest(t, http.Header{"Range": {test.rangeStr}})
+			if w.Code != http.StatusPartialContent {
+				t.Fatalf("expected status %d, got: %d", http.StatusPartialContent, w.Code)
+			}
+
+			if test.parts == nil {
+				if contentRange := w.Header().Get("Content-Range"); contentRange != test.contentRange {
+					t.Errorf("expected content-range '%s', got: '%s'", test.contentRange, contentRange)
+				}
+				return
+			}
+
+			if parts := multipartRanges(t, w); strings.Join(parts, ",") != strings.Join(test.parts, ",") {
+				t.Errorf("expected parts %v, got: %v", test.parts, parts)
+			}
+		})
+	}
+}
+
+func TestCoalesceRangesDisabled(t *testing.T) {
+	w := serveRequest(t, http.Header{"Range": {"bytes=101-200,0-100"}})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("expected status %d, got: %d", http.StatusPartialContent, w.Code)
+	}
+
+	expected := []string{"bytes 101-200/4000", "bytes 0-100/4000"}
+	if parts := multipartRanges(t, w); strings.Join(parts, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the parts in the order requested %v, got: %v", expected, parts)
+	}
+}
+
+func TestFirstLastByteProbe(t *testing.T) {
+	expected := []string{"bytes 0-0/4000", "bytes 3999-3999/4000"}
+
+	for _, coalesce := range []bool{false, true} {
+		for _, header := range []string{"Range", "X-Dolt-Range"} {
+			t.Run(fmt.Sprintf("%s coalesce %t", header, coalesce), func(t *testing.T) {
+				setFlag(t, coalesceRanges, coalesce)
+
+				w := serveRequest(t, http.Header{header: {"bytes=0-0,-1"}})
+				if w.Code != http.StatusPartialContent {
+					t.Fatalf("expected status %d, got: %d", http.StatusPartialContent, w.Code)
+				}
+
+				parts := multipartRanges(t, w)
+				if strings.Join(parts, ",") != strings.Join(expected, ",") {
+					t.Errorf("expected parts %v, got: %v", expected, parts)
+				}
+			})
+		}
+	}
+}
+
+func TestMultiRangeLarge(t *testing.T) {
+	large := sizedContents["/large"]
+
+	serveLarge := func(w http.ResponseWriter, rangeStr string) {
+		req := httptest.NewRequest(http.MethodGet, "/large", nil)
+		req.Header.Set("Range", rangeStr)
+		serveContents(w, req, large, false)
+	}
+
+	t.Run("parts", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		serveLarge(w, "bytes=0-99,-100")
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("expected status %d, got: %d", http.StatusPartialContent, w.Code)
+		}
+		if contentLength := w.Header().Get("Content-Length"); contentLength != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("expected content-length of the %d byte body, got: '%s'", w.Body.Len(), contentLength)
+		}
+
+		_, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		mr := multipart.NewReader(bytes.NewReader(w.Body.Bytes()), params["boundary"])
+		for _, offset := range []int64{0, large.Len() - 100} {
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mismatch := pattern.Verify(*patternSeed, b, offset); len(b) != 100 || mismatch >= 0 {
+				t.Errorf("part %s does not hold the content it describes", part.Header.Get("Content-Range"))
+			}
+		}
+	})
+
+	for _, rangeStr := range []string{"bytes=0-,0-,0-", "bytes=" + strings.TrimSuffix(strings.Repeat("0-,", 128), ",")} {
+		t.Run(fmt.Sprintf("%d overlapping", strings.Count(rangeStr, ",")+1), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			serveLarge(w, rangeStr)
+			if w.Code != http.StatusRequestedRangeNotSatisfiable {
+				t.Fatalf("expected status %d, got: %d", http.StatusRequestedRangeNotSatisfiable, w.Code)
+			}
+			if contentRange := w.Header().Get("Content-Range"); contentRange != "bytes */104857600" {
+				t.Errorf("expected content-range 'bytes */104857600', got: '%s'", contentRange)
+			}
+		})
+	}
+
+	t.Run("streamed", func(t *testing.T) {
+		w := &countingWriter{header: http.Header{}}
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		serveLarge(w, "bytes=0-,0-")
+		runtime.ReadMemStats(&after)
+
+		if contentLength := w.Header().Get("Content-Length"); contentLength != strconv.FormatInt(w.bytes, 10) {
+			t.Errorf("expected content-length of the %d byte body, got: '%s'", w.bytes, contentLength)
+		}
+		if w.bytes < 2*large.Len() {
+			t.Errorf("expected both copies of the content written, got %d bytes", w.bytes)
+		}
+		// the parts are generated a block at a time rather than buffered whole
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+			t.Errorf("expected the parts to be streamed, allocated %d bytes", allocated)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// withoutRanges strips every range source from requests before calling next, so content is always served
+// whole, and advertises `Accept-Ranges: none` in place of `bytes` on the responses.
+func withoutRanges(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		stripped := req.Clone(req.Context())
+		for _, name := range []string{"Range", "X-Dolt-Range", "If-Range"} {
+			if stripped.Header.Get(name) != "" {
+				fmt.Fprintln(logOut, "ignoring header without range support:", name)
+				stripped.Header.Del(name)
+			}
+		}
+
+		query := stripped.URL.Query()
+		for key := range query {
+			if strings.EqualFold(key, "range") {
+				fmt.Fprintln(logOut, "ignoring query param without range support:", key)
+				query.Del(key)
+				stripped.URL.RawQuery = query.Encode()
+			}
+		}
+
+		next.ServeHTTP(&noRangeWriter{ResponseWriter: w}, stripped)
+	})
+}
+
+// noRangeWriter replaces the Accept-Ranges header of content responses with `none`
+type noRangeWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *noRangeWriter) WriteHeader(statusCode int) {
+	// interim responses, ie 103 Early Hints, precede the final response's headers
+	if !w.wroteHeader && statusCode >= http.StatusOK {
+		w.wroteHeader = true
+		if w.Header().Get("Accept-Ranges") != "" {
+			w.Header().Set("Accept-Ranges", "none")
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *noRangeWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *noRangeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets /ws take over the connection through the wrapper
+func (w *noRangeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
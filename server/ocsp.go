@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// loadOCSPStaple reads a DER encoded OCSP response to staple to tls handshakes. The response must
+// parse, but an expired one is only warned about, so clients' handling of stale staples can be tested.
+func loadOCSPStaple(path string) ([]byte, error) {
+	der, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ocsp response: %w", err)
+	}
+
+	res, err := ocsp.ParseResponse(der, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ocsp response: %w", err)
+	}
+
+	if !res.NextUpdate.IsZero() && time.Now().After(res.NextUpdate) {
+		fmt.Fprintln(logOut, "warning: stapled ocsp response expired at", res.NextUpdate.Format(time.RFC3339))
+	}
+	return der, nil
+}
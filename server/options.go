@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// serverAllowedMethods are the methods supported by at least one resource on the server
+const serverAllowedMethods = "GET, HEAD, POST, PUT, OPTIONS"
+
+// withServerOptions answers the server-wide `OPTIONS *` request with the methods the server supports,
+// passing all other requests to next. The request-target `*` doesn't name a path, so it is handled
+// before the request reaches the mux.
+func withServerOptions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodOptions || req.RequestURI != "*" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		fmt.Fprintln(logOut, "received server-wide options request")
+		fmt.Fprintln(logOut, "allow:", serverAllowedMethods)
+		fmt.Fprintln(logOut, "status-code:", http.StatusOK)
+		fmt.Fprintln(logOut)
+
+		w.Header().Add("Allow", serverAllowedMethods)
+		w.Header().Add("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+	})
+}
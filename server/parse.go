@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// parseResponse is how offsetAndLenFromRange interpreted a range for a content size
+type parseResponse struct {
+	Range  string `json:"range"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Error  string `json:"error"`
+}
+
+// serveParse responds with the offset and length offsetAndLenFromRange computes from the `range` query param,
+// or the Range header when the param is absent, for content of the `size` query param's length, defaulting
+// to the size of the built in content. No content is served.
+func serveParse(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(logOut, "received parse request")
+
+	rangeStr := req.URL.Query().Get("range")
+	if rangeStr == "" {
+		rangeStr = req.Header.Get("Range")
+	}
+
+	size := newContents().Len()
+	if sizeParam := req.URL.Query().Get("size"); sizeParam != "" {
+		var err error
+		size, err = strconv.ParseInt(sizeParam, 10, 64)
+		if err != nil || size < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(logOut, "bad request: invalid size query param:", sizeParam)
+			fmt.Fprintln(logOut)
+			return
+		}
+	}
+
+	offset, length, err := offsetAndLenFromRange(rangeStr, size)
+	parsed := parseResponse{Range: rangeStr, Size: size, Offset: offset, Length: length}
+	if err != nil {
+		parsed.Error = err.Error()
+	}
+
+	b, err := json.Marshal(parsed)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(logOut, "failed to encode parse response:", err.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	fmt.Fprintln(logOut, "parsed range:", string(b))
+	fmt.Fprintln(logOut, "status-code:", http.StatusOK)
+	fmt.Fprintln(logOut)
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = w.Write(b); err != nil {
+		fmt.Fprintln(logOut, "failed to write parse response:", err.Error())
+		fmt.Fprintln(logOut)
+	}
+}
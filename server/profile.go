@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	httppprof "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// startProfiles starts the --cpu-profile, returning a func that stops it and writes the --mem-profile
+// once the servers have shut down
+func startProfiles() (func(), error) {
+	var cpuFile *os.File
+	if *cpuProfile != "" {
+		var err error
+		cpuFile, err = os.Create(*cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cpu profile: %w", err)
+		}
+		if err = pprof.StartCPUProfile(cpuFile); err != nil {
+			cpuFile.Close()
+			return nil, fmt.Errorf("failed to start cpu profile: %w", err)
+		}
+		fmt.Fprintln(logOut, "writing cpu profile:", *cpuProfile)
+	}
+
+	return func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				fmt.Fprintln(logOut, "failed to write cpu profile:", err.Error())
+			}
+		}
+		if *memProfile != "" {
+			if err := writeHeapProfile(*memProfile); err != nil {
+				fmt.Fprintln(logOut, "failed to write mem profile:", err.Error())
+			} else {
+				fmt.Fprintln(logOut, "wrote mem profile:", *memProfile)
+			}
+		}
+	}, nil
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// a gc first brings the heap statistics up to date
+	runtime.GC()
+	if err = pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// startPprofServer serves the net/http/pprof handlers at /debug/pprof/ on --pprof-addr, apart from the
+// content servers so profiling doesn't interfere with testing. It keeps serving across SIGHUP reloads.
+func startPprofServer(addr string) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error serving pprof server: %w", err)
+	}
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			fmt.Fprintln(logOut, "error serving pprof server:", err.Error())
+		}
+	}()
+
+	fmt.Fprintln(logOut, "Serving pprof on", ln.Addr().String())
+	return srv, nil
+}
+
+// shutdownPprofServer drains the pprof server, closing it if a profile is still being collected
+func shutdownPprofServer(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fmt.Fprintln(logOut, "pprof server is shutting down")
+	if err := srv.Shutdown(ctx); err != nil {
+		fmt.Fprintln(logOut, "failed to shutdown pprof server", err.Error())
+		srv.Close()
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultRangePrecedence = "range,x-dolt-range,param"
+
+// rangeSource is a place in a request a range may be specified
+type rangeSource struct {
+	desc string
+	get  func(req *http.Request) string
+}
+
+var rangeSources = map[string]rangeSource{
+	"range": {
+		desc: "header: 'range'",
+		get: func(req *http.Request) string {
+			rangeHeader := req.Header.Get("Range")
+			if rangeHeader == "" {
+				rangeHeader = req.Header.Get("range")
+			}
+			return rangeHeader
+		},
+	},
+	"x-dolt-range": {
+		desc: "header: 'x-dolt-range'",
+		get: func(req *http.Request) string {
+			xRangeHeader := req.Header.Get("X-Dolt-Range")
+			if xRangeHeader == "" {
+				xRangeHeader = req.Header.Get("x-dolt-range")
+			}
+			return normalizeDoltRange(xRangeHeader)
+		},
+	},
+	"param": {
+		desc: "query param: 'range'",
+		get: func(req *http.Request) string {
+			rangeParam := req.URL.Query().Get("Range")
+			if rangeParam == "" {
+				rangeParam = req.URL.Query().Get("range")
+			}
+			return rangeParam
+		},
+	},
+}
+
+// normalizeDoltRange accepts the bare suffix form `-N` for the last N bytes that dolt clients send in
+// X-Dolt-Range, as `bytes=-N`
+func normalizeDoltRange(rangeStr string) string {
+	if strings.HasPrefix(rangeStr, "-") {
+		return "bytes=" + rangeStr
+	}
+	return rangeStr
+}
+
+// rangePrecedence is the order range sources are checked in, the first one present in a request is served
+var rangePrecedence []rangeSource
+
+// parseRangePrecedence parses a comma separated ordering of range sources, ie `param,x-dolt-range,range`.
+// Sources that are left out are never honored.
+func parseRangePrecedence(spec string) ([]rangeSource, error) {
+	var sources []rangeSource
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		src, ok := rangeSources[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown range source '%s', expected range, x-dolt-range or param", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("range source '%s' listed more than once", name)
+		}
+		seen[name] = true
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// findRange returns the range string from the highest precedence source present in the request. Ranges are
+// never read from request trailers, which arrive with the request body after the response may have begun.
+func findRange(req *http.Request) (rangeSource, string, bool) {
+	for _, src := range rangePrecedence {
+		if rangeStr := src.get(req); rangeStr != "" {
+			return src, rangeStr, true
+		}
+	}
+	return rangeSource{}, "", false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// route is a path served by the server, the methods it accepts and the handler serving them. A route
+// without methods accepts any method.
+type route struct {
+	path    string
+	methods []string
+	handler http.HandlerFunc
+}
+
+// serverRoutes are the routes served by both the http and https servers
+func serverRoutes(vbs bool) []route {
+	readOnly := []string{http.MethodGet, http.MethodHead}
+
+	routes := []route{
+		{path: "/", methods: readOnly, handler: func(writer http.ResponseWriter, request *http.Request) {
+			serveObjects(writer, request, vbs)
+		}},
+		{path: "/batch", methods: []string{http.MethodPost}, handler: func(writer http.ResponseWriter, request *http.Request) {
+			serveBatch(writer, request, newContents(), vbs)
+		}},
+		{path: "/echo", handler: serveEcho},
+		{path: "/health", methods: readOnly, handler: serveHealth},
+		{path: "/metrics", methods: readOnly, handler: serveMetrics},
+		{path: "/parse", methods: readOnly, handler: serveParse},
+		{path: "/upload", methods: []string{http.MethodPut}, handler: serveUpload},
+		{path: "/slow", methods: readOnly, handler: func(writer http.ResponseWriter, request *http.Request) {
+			serveSlow(writer, request, newContents(), vbs)
+		}},
+		{path: "/ws", methods: []string{http.MethodGet}, handler: serveWebsocket},
+	}
+
+	for _, sized := range sizedRoutes {
+		path := sized.path
+		routes = append(routes, route{path: path, methods: readOnly, handler: func(writer http.ResponseWriter, request *http.Request) {
+			serveContents(writer, request, sizedContents[path], vbs)
+		}})
+	}
+	return routes
+}
+
+// registerRoutes registers each route on mux, adding header to every response. `OPTIONS` requests to a
+// route are answered with the methods it accepts in an Allow header, and requests with any other method it
+// doesn't accept with `405 Method Not Allowed`.
+func registerRoutes(mux *http.ServeMux, routes []route, header http.Header) {
+	for _, rt := range routes {
+		rt := rt
+		allow := strings.Join(append(append([]string{}, rt.methods...), http.MethodOptions), ", ")
+
+		mux.HandleFunc(rt.path, func(w http.ResponseWriter, req *http.Request) {
+			for name, values := range header {
+				for _, value := range values {
+					w.Header().Add(name, value)
+				}
+			}
+
+			if rt.methods == nil || rt.allows(req.Method) {
+				rt.handler(w, req)
+				return
+			}
+
+			statusCode := http.StatusMethodNotAllowed
+			if req.Method == http.MethodOptions {
+				fmt.Fprintln(logOut, "received options request:", req.URL.Path)
+				statusCode = http.StatusOK
+			} else {
+				fmt.Fprintln(logOut, "method not allowed:", req.Method, req.URL.Path)
+			}
+			fmt.Fprintln(logOut, "allow:", allow)
+			fmt.Fprintln(logOut, "status-code:", statusCode)
+			fmt.Fprintln(logOut)
+
+			w.Header().Add("Allow", allow)
+			w.Header().Add("Content-Length", "0")
+			w.WriteHeader(statusCode)
+		})
+	}
+}
+
+func (rt route) allows(method string) bool {
+	for _, m := range rt.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// addServerTiming adds a Server-Timing metric with a duration in milliseconds, ie `range;dur=1.2`
+func addServerTiming(h http.Header, name string, d time.Duration) {
+	h.Add("Server-Timing", fmt.Sprintf("%s;dur=%.1f", name, float64(d.Microseconds())/1000))
+}
+
+// serverTimingWriter adds a `total` Server-Timing metric covering the time from the start of the request
+// until its headers are written, including any injected delays. The body is written after the headers are
+// sent, so the time spent writing it is logged instead.
+type serverTimingWriter struct {
+	http.ResponseWriter
+	start       time.Time
+	headersSent time.Time
+}
+
+func newServerTimingWriter(w http.ResponseWriter) *serverTimingWriter {
+	return &serverTimingWriter{ResponseWriter: w, start: time.Now()}
+}
+
+func (w *serverTimingWriter) WriteHeader(statusCode int) {
+	if w.headersSent.IsZero() {
+		addServerTiming(w.Header(), "total", time.Since(w.start))
+		w.headersSent = time.Now()
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *serverTimingWriter) Write(b []byte) (int, error) {
+	if w.headersSent.IsZero() {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *serverTimingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// logWriteDuration logs how long the body took to write once the handler returns
+func (w *serverTimingWriter) logWriteDuration() {
+	if !w.headersSent.IsZero() {
+		fmt.Fprintln(logOut, "body write duration:", time.Since(w.headersSent))
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "sync"
+
+// sizedRoutes are the built in routes serving generated content of fixed sizes, for range testing across
+// sizes without configuring any content
+var sizedRoutes = []struct {
+	path string
+	size int64
+}{
+	{path: "/small", size: 1 << 10},
+	{path: "/medium", size: 1 << 20},
+	{path: "/large", size: 100 << 20},
+}
+
+// newGeneratedContents returns size bytes of the pattern content generated from seed. Reads produce the
+// bytes requested from their offsets, so the content is never held in memory whole.
+func newGeneratedContents(seed, size int64) *inMemContents {
+	return &inMemContents{
+		mu:        &sync.Mutex{},
+		modTime:   startTime,
+		generated: true,
+		seed:      seed,
+		size:      size,
+	}
+}
+
+// sizedContents holds the content of each sized route by path. It is replaced by configure, so the routes
+// serve content generated from a reloaded --pattern-seed.
+var sizedContents map[string]*inMemContents
+
+func newSizedContents() map[string]*inMemContents {
+	sized := make(map[string]*inMemContents)
+	for _, rt := range sizedRoutes {
+		sized[rt.path] = newGeneratedContents(*patternSeed, rt.size)
+	}
+	return sized
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dolthub/headers_tester/pattern"
+)
+
+func TestSizedRoutesServeGeneratedRanges(t *testing.T) {
+	large := sizedContents["/large"]
+
+	tests := []struct {
+		rangeStr     string
+		offset       int64
+		length       int64
+		contentRange string
+	}{
+		{rangeStr: "bytes=0-99", offset: 0, length: 100, contentRange: "bytes 0-99/104857600"},
+		{rangeStr: "bytes=1048570-1048589", offset: 1048570, length: 20, contentRange: "bytes 1048570-1048589/104857600"},
+		{rangeStr: "bytes=-80", offset: 104857520, length: 80, contentRange: "bytes 104857520-104857599/104857600"},
+		{rangeStr: "bytes=103809024-", offset: 103809024, length: 1 << 20, contentRange: "bytes 103809024-104857599/104857600"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rangeStr, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/large", nil)
+			req.Header.Set("Range", test.rangeStr)
+			w := httptest.NewRecorder()
+			serveContents(w, req, large, false)
+
+			if w.Code != http.StatusPartialContent {
+				t.Fatalf("expected status %d, got: %d", http.StatusPartialContent, w.Code)
+			}
+			if contentRange := w.Header().Get("Content-Range"); contentRange != test.contentRange {
+				t.Errorf("expected content-range '%s', got: '%s'", test.contentRange, contentRange)
+			}
+			if int64(w.Body.Len()) != test.length {
+				t.Fatalf("expected a %d byte body, got: %d", test.length, w.Body.Len())
+			}
+			if mismatch := pattern.Verify(*patternSeed, w.Body.Bytes(), test.offset); mismatch >= 0 {
+				t.Errorf("body differs from the pattern content at offset %d", mismatch)
+			}
+		})
+	}
+}
+
+func TestGeneratedContentsWriteRange(t *testing.T) {
+	contents := newGeneratedContents(7, 3*generatedBlockSize+15)
+
+	var writes int
+	var written []byte
+	n, err := contents.writeRange(10, contents.Len(), func(b []byte) (int, error) {
+		writes++
+		written = append(written, b...)
+		return len(b), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != contents.Len()-10 || int64(len(written)) != n {
+		t.Fatalf("expected %d bytes written, got: %d", contents.Len()-10, n)
+	}
+	if writes != 4 {
+		t.Errorf("expected the content to be written in 4 blocks, got: %d", writes)
+	}
+	if mismatch := pattern.Verify(7, written, 10); mismatch >= 0 {
+		t.Errorf("written content differs from the pattern content at offset %d", mismatch)
+	}
+}
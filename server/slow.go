@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultSlowBytesPerSecond = 1024
+
+// serveSlow serves contents like serveContents, honoring ranges, with the body written at the rate
+// given by the `bps` query param in bytes per second.
+func serveSlow(w http.ResponseWriter, req *http.Request, contents *inMemContents, vbs bool) {
+	bps := defaultSlowBytesPerSecond
+	if bpsParam := req.URL.Query().Get("bps"); bpsParam != "" {
+		var err error
+		bps, err = strconv.Atoi(bpsParam)
+		if err != nil || bps <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(logOut, "bad request: invalid bps query param:", bpsParam)
+			fmt.Fprintln(logOut)
+			return
+		}
+	}
+
+	fmt.Fprintln(logOut, "serving slowly at bytes per second:", bps)
+	serveContents(&throttledWriter{ResponseWriter: w, ctx: req.Context(), bytesPerSecond: bps}, req, contents, vbs)
+}
+
+// throttledWriter writes response bodies at a fixed rate, flushing every tenth of a second of transfer
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx            context.Context
+	bytesPerSecond int
+}
+
+func (t *throttledWriter) Write(b []byte) (int, error) {
+	slice := t.bytesPerSecond / 10
+	if slice < 1 {
+		slice = 1
+	}
+
+	written := 0
+	for written < len(b) {
+		end := written + slice
+		if end > len(b) {
+			end = len(b)
+		}
+
+		n, err := t.ResponseWriter.Write(b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		t.Flush()
+
+		if written < len(b) {
+			if err = sleepContext(t.ctx, time.Duration(n)*time.Second/time.Duration(t.bytesPerSecond)); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (t *throttledWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
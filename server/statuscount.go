@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// statusCounts counts the requests answered with each status code over the server's lifetime, across
+// reloads
+var statusCounts [600]atomic.Int64
+
+// withStatusCounts counts the final status of every response written by next
+func withStatusCounts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sw := &statusCountWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, req)
+
+		// net/http answers 200 for handlers that write nothing
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status > 0 && status < len(statusCounts) {
+			statusCounts[status].Add(1)
+		}
+	})
+}
+
+// statusCountWriter records the final status code written through it
+type statusCountWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusCountWriter) WriteHeader(statusCode int) {
+	// interim responses, ie 103 Early Hints, precede the final status
+	if w.status == 0 && statusCode >= http.StatusOK {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusCountWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusCountWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets /ws take over the connection, which is counted as switching protocols
+func (w *statusCountWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// printStatusCounts logs the number of requests answered with each status code, ie `200: 42, 206: 317`
+func printStatusCounts() {
+	var counts []string
+	for status := range statusCounts {
+		if n := statusCounts[status].Load(); n > 0 {
+			counts = append(counts, fmt.Sprintf("%d: %d", status, n))
+		}
+	}
+
+	if len(counts) == 0 {
+		fmt.Fprintln(logOut, "requests by status: none")
+		return
+	}
+	fmt.Fprintln(logOut, "requests by status:", strings.Join(counts, ", "))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// serveTarpit sends headers and then trickles a single byte of content every interval, never
+// completing the response. It returns once the client disconnects or the server shuts down.
+func serveTarpit(w http.ResponseWriter, req *http.Request, contents *inMemContents, interval time.Duration) {
+	fmt.Fprintln(logOut, "tarpit: holding connection from", req.RemoteAddr)
+	fmt.Fprintln(logOut)
+
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	// there is nothing to trickle from empty content, so its response ends with the headers
+	size := contents.Len()
+	if size == 0 {
+		fmt.Fprintln(logOut, "tarpit: released connection from", req.RemoteAddr, "content is empty")
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for i := int64(0); ; i = (i + 1) % size {
+		b, _ := contents.ReadRange(i, i+1)
+		if _, err := w.Write(b); err != nil {
+			fmt.Fprintln(logOut, "tarpit: released connection from", req.RemoteAddr, "write failed:", err.Error())
+			fmt.Fprintln(logOut)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-req.Context().Done():
+			fmt.Fprintln(logOut, "tarpit: released connection from", req.RemoteAddr, req.Context().Err().Error())
+			fmt.Fprintln(logOut)
+			return
+		case <-ticker.C:
+		}
+	}
+}
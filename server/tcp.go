@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// listen binds a tcp listener to addr whose accepted connections are tuned by --tcp-keepalive and
+// --tcp-nodelay
+func listen(addr string) (net.Listener, error) {
+	// net.ListenConfig treats 0 as its default keepalive period and a negative period as disabled
+	lc := net.ListenConfig{KeepAlive: *tcpKeepAlive}
+	if *tcpKeepAlive == 0 {
+		lc.KeepAlive = -1
+	}
+
+	ln, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &noDelayListener{Listener: ln, noDelay: *tcpNoDelay}, nil
+}
+
+// noDelayListener sets TCP_NODELAY on accepted connections. When it is off, Nagle's algorithm coalesces
+// small writes, delaying small responses until earlier segments are acknowledged.
+type noDelayListener struct {
+	net.Listener
+	noDelay bool
+}
+
+func (l *noDelayListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err := tcpConn.SetNoDelay(l.noDelay); err != nil {
+			fmt.Fprintln(logOut, "failed to set tcp nodelay:", err.Error())
+		}
+	}
+	return conn, nil
+}
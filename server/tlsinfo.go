@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+var tlsCurveIDs = map[string]tls.CurveID{
+	"x25519": tls.X25519,
+	"p256":   tls.CurveP256,
+	"p384":   tls.CurveP384,
+	"p521":   tls.CurveP521,
+}
+
+// curvePreferences is the parsed --tls-curves
+var curvePreferences []tls.CurveID
+
+// parseTLSCurves parses a comma separated list of elliptic curves in order of preference, ie `x25519,p256`
+func parseTLSCurves(spec string) ([]tls.CurveID, error) {
+	var curves []tls.CurveID
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		curve, ok := tlsCurveIDs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls curve '%s', expected x25519, p256, p384 or p521", name)
+		}
+		curves = append(curves, curve)
+	}
+	return curves, nil
+}
+
+func tlsVersionName(version uint16) string {
+	if name, ok := tlsVersionNames[version]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// withTLSInfo adds response headers describing the negotiated tls connection before calling next
+func withTLSInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.TLS != nil {
+			w.Header().Add("X-TLS-Version", tlsVersionName(req.TLS.Version))
+			w.Header().Add("X-TLS-Cipher", tls.CipherSuiteName(req.TLS.CipherSuite))
+			w.Header().Add("X-TLS-Client-Cert", strconv.FormatBool(len(req.TLS.PeerCertificates) > 0))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// alpnProtocol describes a negotiated alpn protocol, which is empty if the client offered none or
+// there was no protocol in common
+func alpnProtocol(proto string) string {
+	if proto == "" {
+		return "none"
+	}
+	return proto
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// contentDigestTrailer carries the sha256 of the response body as written
+const contentDigestTrailer = "X-Content-Sha256"
+
+// acceptsTrailers reports whether the request indicated support for trailers with `TE: trailers`.
+// http/1.0 has no chunked encoding to carry trailers.
+func acceptsTrailers(req *http.Request) bool {
+	if !req.ProtoAtLeast(1, 1) {
+		return false
+	}
+	for _, te := range req.Header.Values("TE") {
+		for _, token := range strings.Split(te, ",") {
+			name, _, _ := strings.Cut(token, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trailerWriter declares a digest trailer on successful responses and hashes the body as it is written.
+// Content-Length is dropped so the body is chunked, which http/1.1 requires to send trailers.
+type trailerWriter struct {
+	http.ResponseWriter
+	digest      hash.Hash
+	declared    bool
+	wroteHeader bool
+}
+
+func newTrailerWriter(w http.ResponseWriter) *trailerWriter {
+	return &trailerWriter{ResponseWriter: w, digest: sha256.New()}
+}
+
+func (w *trailerWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if statusCode == http.StatusOK || statusCode == http.StatusPartialContent {
+			w.declared = true
+			w.Header().Del("Content-Length")
+			w.Header().Set("Trailer", contentDigestTrailer)
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *trailerWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.digest.Write(b[:n])
+	return n, err
+}
+
+func (w *trailerWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeTrailers sets the digest trailer once the body has been written
+func (w *trailerWriter) writeTrailers() {
+	if !w.declared {
+		return
+	}
+	w.Header().Set(contentDigestTrailer, hex.EncodeToString(w.digest.Sum(nil)))
+}
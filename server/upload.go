@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// maxBodySize is the parsed --max-body-size, the largest request body /batch and /upload accept
+var maxBodySize int64
+
+// limitBody caps the request body at --max-body-size, reads beyond it fail with an *http.MaxBytesError
+func limitBody(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, maxBodySize)
+}
+
+// isBodyTooLarge reports whether err is from reading past the --max-body-size limit
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, size int64) {
+	fmt.Fprintln(logOut, "request body too large:", size, "max:", maxBodySize)
+	fmt.Fprintln(logOut, "status-code:", http.StatusRequestEntityTooLarge)
+	fmt.Fprintln(logOut)
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+}
+
+// uploadResponse reports the body received by /upload
+type uploadResponse struct {
+	Received int64 `json:"received"`
+}
+
+// serveUpload accepts a PUT body, validating it matches its Content-Length. net/http answers an
+// `Expect: 100-continue` with `100 Continue` when the body is first read.
+func serveUpload(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(logOut, "received upload request")
+	fmt.Fprintln(logOut, "expect:", req.Header.Get("Expect"))
+
+	if req.ContentLength < 0 {
+		fmt.Fprintln(logOut, "status-code:", http.StatusLengthRequired)
+		fmt.Fprintln(logOut)
+		w.WriteHeader(http.StatusLengthRequired)
+		return
+	}
+	if req.ContentLength > maxBodySize {
+		writeBodyTooLarge(w, req.ContentLength)
+		return
+	}
+
+	limitBody(w, req)
+	n, err := io.Copy(io.Discard, req.Body)
+	if err != nil || n != req.ContentLength {
+		fmt.Fprintln(logOut, "upload did not match content-length:", req.ContentLength, "received:", n)
+		fmt.Fprintln(logOut, "status-code:", http.StatusBadRequest)
+		fmt.Fprintln(logOut)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	b, err := json.Marshal(uploadResponse{Received: n})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(logOut, "failed to encode upload response:", err.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	fmt.Fprintln(logOut, "received bytes:", n)
+	fmt.Fprintln(logOut, "status-code:", http.StatusOK)
+	fmt.Fprintln(logOut)
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = w.Write(b); err != nil {
+		fmt.Fprintln(logOut, "failed to write upload response:", err.Error())
+		fmt.Fprintln(logOut)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// websocketGUID is appended to the client's key to compute Sec-WebSocket-Accept, see RFC 6455 section 1.3
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const maxWebsocketPayload = 1 << 20
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+var errWebsocketFrameTooLarge = errors.New("websocket frame too large")
+var errWebsocketUnmasked = errors.New("websocket client frame is not masked")
+
+// serveWebsocket performs a websocket handshake and echoes every data frame received back to the
+// client until it closes the connection or the server shuts down.
+func serveWebsocket(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(logOut, "received websocket request")
+
+	if !headerHasToken(req.Header, "Connection", "upgrade") || !headerHasToken(req.Header, "Upgrade", "websocket") {
+		rejectWebsocket(w, http.StatusUpgradeRequired, "missing websocket upgrade headers")
+		return
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Add("Sec-WebSocket-Version", "13")
+		rejectWebsocket(w, http.StatusUpgradeRequired, "unsupported websocket version")
+		return
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		rejectWebsocket(w, http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		rejectWebsocket(w, http.StatusBadRequest, "websocket upgrades require http/1.1")
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		fmt.Fprintln(logOut, "failed to hijack websocket connection:", err.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+	defer conn.Close()
+
+	// hijacked connections aren't closed by server shutdown, so close it when the request is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-req.Context().Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	_, err = fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(logOut, "failed to write websocket handshake:", err.Error())
+		fmt.Fprintln(logOut)
+		return
+	}
+
+	fmt.Fprintln(logOut, "status-code:", http.StatusSwitchingProtocols)
+	fmt.Fprintln(logOut)
+
+	echoWebsocket(conn, rw.Reader)
+}
+
+func rejectWebsocket(w http.ResponseWriter, statusCode int, reason string) {
+	fmt.Fprintln(logOut, "bad websocket request:", reason)
+	fmt.Fprintln(logOut, "status-code:", statusCode)
+	fmt.Fprintln(logOut)
+
+	if statusCode == http.StatusUpgradeRequired {
+		w.Header().Add("Upgrade", "websocket")
+		w.Header().Add("Connection", "Upgrade")
+	}
+	w.WriteHeader(statusCode)
+	if _, err := io.WriteString(w, reason); err != nil {
+		fmt.Fprintln(logOut, err.Error())
+	}
+}
+
+func echoWebsocket(conn net.Conn, r *bufio.Reader) {
+	for {
+		fin, opcode, payload, err := readWebsocketFrame(r)
+		if err != nil {
+			if errors.Is(err, errWebsocketFrameTooLarge) {
+				// 1009 message too big
+				_ = writeWebsocketFrame(conn, true, wsOpClose, []byte{0x03, 0xF1})
+			}
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				fmt.Fprintln(logOut, "websocket read failed:", err.Error())
+				fmt.Fprintln(logOut)
+			}
+			return
+		}
+
+		switch opcode {
+		case wsOpText, wsOpBinary, wsOpContinuation:
+			err = writeWebsocketFrame(conn, fin, opcode, payload)
+		case wsOpPing:
+			err = writeWebsocketFrame(conn, true, wsOpPong, payload)
+		case wsOpPong:
+		case wsOpClose:
+			_ = writeWebsocketFrame(conn, true, wsOpClose, payload)
+			fmt.Fprintln(logOut, "websocket closed by client")
+			fmt.Fprintln(logOut)
+			return
+		default:
+			// 1002 protocol error
+			_ = writeWebsocketFrame(conn, true, wsOpClose, []byte{0x03, 0xEA})
+			fmt.Fprintf(logOut, "websocket received unknown opcode: 0x%x\n", opcode)
+			fmt.Fprintln(logOut)
+			return
+		}
+
+		if err != nil {
+			fmt.Fprintln(logOut, "websocket write failed:", err.Error())
+			fmt.Fprintln(logOut)
+			return
+		}
+	}
+}
+
+func readWebsocketFrame(r *bufio.Reader) (bool, byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := hdr[0]&0x80 != 0
+	opcode := hdr[0] & 0x0F
+	if hdr[1]&0x80 == 0 {
+		return false, 0, nil, errWebsocketUnmasked
+	}
+
+	length := uint64(hdr[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if length > maxWebsocketPayload {
+		return false, 0, nil, errWebsocketFrameTooLarge
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeWebsocketFrame writes an unmasked frame, as required for frames sent by a server
+func writeWebsocketFrame(w io.Writer, fin bool, opcode byte, payload []byte) error {
+	hdr := make([]byte, 2, 10)
+	hdr[0] = opcode
+	if fin {
+		hdr[0] |= 0x80
+	}
+
+	switch {
+	case len(payload) < 126:
+		hdr[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(len(payload)))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(len(payload)))
+	}
+
+	if _, err := w.Write(append(hdr, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerHasToken reports whether any of the comma separated values of a header is token, ignoring case
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
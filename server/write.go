@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// responseBufferSize is the parsed --response-buffer, 0 when unset
+var responseBufferSize int
+
+// writeBody writes b to w, in chunks of --write-chunk bytes with a flush after each when set. Otherwise,
+// with --response-buffer, b is written through a buffer of that size which is flushed at the end.
+func writeBody(w http.ResponseWriter, b []byte) (int, error) {
+	chunkSize := *writeChunk
+	if chunkSize <= 0 || chunkSize >= len(b) {
+		if responseBufferSize > 0 {
+			return writeBuffered(w, b)
+		}
+		return writeFull(w, b)
+	}
+
+	flusher, _ := w.(http.Flusher)
+
+	written := 0
+	for written < len(b) {
+		end := written + chunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+
+		n, err := writeFull(w, b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	return written, nil
+}
+
+// writeFull writes all of b to w, continuing after partial writes. It only gives up when a write fails or
+// makes no progress, as the connection is then broken, so all of b was written when it returns no error.
+func writeFull(w io.Writer, b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := w.Write(b[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+		if written < len(b) {
+			fmt.Fprintln(logOut, "short write, continuing:", written, "of", len(b))
+		}
+	}
+	return written, nil
+}
+
+// writeBuffered writes b to w through a bufio.Writer of --response-buffer bytes
+func writeBuffered(w http.ResponseWriter, b []byte) (int, error) {
+	bw := bufio.NewWriterSize(w, responseBufferSize)
+
+	// bufio writes slices larger than its buffer straight through, so feed it a buffer at a time
+	written := 0
+	for written < len(b) {
+		end := written + responseBufferSize
+		if end > len(b) {
+			end = len(b)
+		}
+
+		n, err := bw.Write(b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, bw.Flush()
+}
+
+// discardBodyWriter computes responses as usual but discards their bodies, for benchmarking the header and
+// range handling in isolation. Content-Length is replaced with 0, and the length that would have been
+// sent is reported in X-Discarded-Content-Length.
+type discardBodyWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *discardBodyWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if contentLength := w.Header().Get("Content-Length"); contentLength != "" {
+			w.Header().Set("X-Discarded-Content-Length", contentLength)
+		}
+		w.Header().Set("Content-Length", "0")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *discardBodyWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return len(b), nil
+}
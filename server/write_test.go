@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// countingWriter discards response bodies, counting the writes that reach it as a stand in for the
+// syscalls made writing to a connection
+type countingWriter struct {
+	header http.Header
+	writes int
+	bytes  int64
+}
+
+func (w *countingWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	w.bytes += int64(len(b))
+	return len(b), nil
+}
+
+func (w *countingWriter) WriteHeader(int) {}
+
+func BenchmarkWriteBody(b *testing.B) {
+	body := make([]byte, 10<<20)
+
+	benchmarks := []struct {
+		name       string
+		bufferSize int
+		chunkSize  int
+	}{
+		{name: "unbuffered"},
+		{name: "buffer 4KB", bufferSize: 4 << 10},
+		{name: "buffer 64KB", bufferSize: 64 << 10},
+		{name: "buffer 1MB", bufferSize: 1 << 20},
+		{name: "chunk 4KB", chunkSize: 4 << 10},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			setFlag(b, &responseBufferSize, bm.bufferSize)
+			setFlag(b, writeChunk, bm.chunkSize)
+
+			w := &countingWriter{header: http.Header{}}
+			b.SetBytes(int64(len(body)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := writeBody(w, body); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(w.writes)/float64(b.N), "writes/op")
+		})
+	}
+}
+
+func TestDiscardBodyWithTrailers(t *testing.T) {
+	setFlag(t, discardBody, true)
+
+	w := serveRequest(t, http.Header{"Te": {"trailers"}, "Range": {"bytes=0-99"}})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("expected status %d, got: %d", http.StatusPartialContent, w.Code)
+	}
+	if contentLength := w.Header().Get("Content-Length"); contentLength != "0" {
+		t.Errorf("expected content-length '0', got: '%s'", contentLength)
+	}
+	if discarded := w.Header().Get("X-Discarded-Content-Length"); discarded != "100" {
+		t.Errorf("expected x-discarded-content-length '100', got: '%s'", discarded)
+	}
+	if trailer := w.Header().Get("Trailer"); trailer != "" {
+		t.Errorf("expected no trailer declared, got: '%s'", trailer)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("expected an empty body, got %d bytes", w.Body.Len())
+	}
+}
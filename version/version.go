@@ -0,0 +1,68 @@
+// Package version reports build information for the headers tester binaries.
+package version
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// These are injected at build time, ie
+// go build -ldflags "-X github.com/dolthub/headers_tester/version.Version=v1.0.0"
+var (
+	Version = ""
+	Commit  = ""
+	Date    = ""
+)
+
+// Info holds the version, git commit and build date of a binary.
+type Info struct {
+	Version string
+	Commit  string
+	Date    string
+}
+
+// Get returns the build information injected via ldflags, falling back to the
+// module and vcs information embedded by the go toolchain for any unset value.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	if info.Version == "" {
+		info.Version = bi.Main.Version
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = s.Value
+			}
+		}
+	}
+
+	return info
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("version: %s commit: %s build date: %s", orUnknown(i.Version), orUnknown(i.Commit), orUnknown(i.Date))
+}
+
+// Print writes the build information of the named binary to stdout.
+func Print(name string) {
+	fmt.Println(name, Get().String())
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}